@@ -0,0 +1,145 @@
+package es
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Aggregations 查询结果中的聚合，按名称取出后解码为对应类型
+type Aggregations map[string]json.RawMessage
+
+// BucketAggregation terms、date_histogram、histogram、range 等分桶聚合
+type BucketAggregation struct {
+	DocCountErrorUpperBound int64
+	SumOtherDocCount        int64
+	Buckets                 []Bucket
+}
+
+type Bucket struct {
+	// Key terms 为字符串或数字，date_histogram 为毫秒时间戳
+	Key         interface{}
+	KeyAsString string
+	DocCount    int64
+	// From/To range 聚合的区间
+	From *float64
+	To   *float64
+	// Aggregations 子聚合
+	Aggregations Aggregations
+}
+
+// StatsAggregation stats 聚合，没有文档时 Min/Max/Avg 为空
+type StatsAggregation struct {
+	Count int64    `json:"count"`
+	Min   *float64 `json:"min"`
+	Max   *float64 `json:"max"`
+	Avg   *float64 `json:"avg"`
+	Sum   float64  `json:"sum"`
+}
+
+// Terms 取出分桶聚合，名称不存在时返回 false
+func (a Aggregations) Terms(name string) (*BucketAggregation, bool) {
+	raw, ok := a[name]
+	if !ok {
+		return nil, false
+	}
+	var agg struct {
+		DocCountErrorUpperBound int64           `json:"doc_count_error_upper_bound"`
+		SumOtherDocCount        int64           `json:"sum_other_doc_count"`
+		Buckets                 json.RawMessage `json:"buckets"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, false
+	}
+	result := &BucketAggregation{
+		DocCountErrorUpperBound: agg.DocCountErrorUpperBound,
+		SumOtherDocCount:        agg.SumOtherDocCount,
+	}
+	if err := json.Unmarshal(agg.Buckets, &result.Buckets); err != nil {
+		// keyed 聚合的 buckets 是以 key 为键的对象
+		var keyed map[string]Bucket
+		if json.Unmarshal(agg.Buckets, &keyed) != nil {
+			return nil, false
+		}
+		for k, b := range keyed {
+			if b.Key == nil {
+				b.Key = k
+			}
+			result.Buckets = append(result.Buckets, b)
+		}
+	}
+	return result, true
+}
+
+// DateHistogram 与 Terms 相同，Key 为毫秒时间戳
+func (a Aggregations) DateHistogram(name string) (*BucketAggregation, bool) {
+	return a.Terms(name)
+}
+
+func (a Aggregations) Stats(name string) (*StatsAggregation, bool) {
+	raw, ok := a[name]
+	if !ok {
+		return nil, false
+	}
+	var agg StatsAggregation
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, false
+	}
+	return &agg, true
+}
+
+// Value avg、sum、min、max、cardinality、value_count 等单值聚合，没有文档时为空
+func (a Aggregations) Value(name string) (*float64, bool) {
+	raw, ok := a[name]
+	if !ok {
+		return nil, false
+	}
+	var agg struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return nil, false
+	}
+	return agg.Value, true
+}
+
+// Decode 把聚合解码为自定义结构，用于其他类型的聚合
+func (a Aggregations) Decode(name string, v interface{}) error {
+	raw, ok := a[name]
+	if !ok {
+		return fmt.Errorf("es: aggregation %s not found", name)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// UnmarshalJSON 除 key、doc_count 等固定字段外的字段都作为子聚合
+func (b *Bucket) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for k, v := range fields {
+		var err error
+		switch k {
+		case "key":
+			err = json.Unmarshal(v, &b.Key)
+		case "key_as_string":
+			err = json.Unmarshal(v, &b.KeyAsString)
+		case "doc_count":
+			err = json.Unmarshal(v, &b.DocCount)
+		case "from":
+			err = json.Unmarshal(v, &b.From)
+		case "to":
+			err = json.Unmarshal(v, &b.To)
+		case "from_as_string", "to_as_string":
+		default:
+			if b.Aggregations == nil {
+				b.Aggregations = Aggregations{}
+			}
+			b.Aggregations[k] = v
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package es
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const aggsResponse = `{
+	"by_status": {
+		"doc_count_error_upper_bound": 0,
+		"sum_other_doc_count": 5,
+		"buckets": [
+			{"key": "ok", "doc_count": 10, "latency": {"count": 10, "min": 1, "max": 9, "avg": 5, "sum": 50}},
+			{"key": 404, "doc_count": 2}
+		]
+	},
+	"by_range": {
+		"buckets": {
+			"low": {"to": 10, "doc_count": 1},
+			"high": {"key": "high", "from": 10, "from_as_string": "10", "doc_count": 3}
+		}
+	},
+	"empty": {"count": 0, "min": null, "max": null, "avg": null, "sum": 0},
+	"total": {"value": 42}
+}`
+
+func TestAggregations(t *testing.T) {
+	var aggs Aggregations
+	if err := json.Unmarshal([]byte(aggsResponse), &aggs); err != nil {
+		t.Fatal(err)
+	}
+
+	terms, ok := aggs.Terms("by_status")
+	if !ok || terms.SumOtherDocCount != 5 || len(terms.Buckets) != 2 {
+		t.Fatalf("Terms = %+v, %v", terms, ok)
+	}
+	b := terms.Buckets[0]
+	if b.Key != "ok" || b.DocCount != 10 {
+		t.Fatalf("bucket = %+v", b)
+	}
+	if terms.Buckets[1].Key != float64(404) {
+		t.Fatalf("numeric key = %#v", terms.Buckets[1].Key)
+	}
+	stats, ok := b.Aggregations.Stats("latency")
+	if !ok || stats.Count != 10 || stats.Avg == nil || *stats.Avg != 5 {
+		t.Fatalf("sub aggregation = %+v, %v", stats, ok)
+	}
+	if terms.Buckets[1].Aggregations != nil {
+		t.Fatalf("unexpected sub aggregations %v", terms.Buckets[1].Aggregations)
+	}
+
+	ranges, ok := aggs.Terms("by_range")
+	if !ok || len(ranges.Buckets) != 2 {
+		t.Fatalf("keyed Terms = %+v, %v", ranges, ok)
+	}
+	for _, b := range ranges.Buckets {
+		switch b.Key {
+		case "low":
+			if b.To == nil || *b.To != 10 || b.From != nil {
+				t.Errorf("low bucket = %+v", b)
+			}
+		case "high":
+			if b.From == nil || *b.From != 10 || b.DocCount != 3 || b.Aggregations != nil {
+				t.Errorf("high bucket = %+v", b)
+			}
+		default:
+			t.Errorf("unexpected key %v", b.Key)
+		}
+	}
+
+	empty, ok := aggs.Stats("empty")
+	if !ok || empty.Min != nil || empty.Avg != nil {
+		t.Fatalf("empty stats = %+v, %v", empty, ok)
+	}
+	if v, ok := aggs.Value("total"); !ok || v == nil || *v != 42 {
+		t.Fatalf("Value = %v, %v", v, ok)
+	}
+	if _, ok := aggs.Terms("missing"); ok {
+		t.Fatal("missing aggregation found")
+	}
+}
@@ -0,0 +1,382 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	BulkIndex  = "index"
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+const (
+	defaultFlushBytes    = 5 << 20
+	defaultFlushDocs     = 1000
+	defaultFlushInterval = time.Second
+	defaultBulkRetries   = 3
+	defaultRetryBackoff  = 200 * time.Millisecond
+	maxRetryBackoff      = 30 * time.Second
+)
+
+var ErrBulkClosed = errors.New("es: bulk indexer closed")
+
+type BulkConfig struct {
+	// Index 默认索引，BulkItem.Index 为空时使用
+	Index string
+	// FlushBytes 请求体达到该大小时发送，默认 5MB
+	FlushBytes int
+	// FlushDocs 文档数达到该数量时发送，默认 1000
+	FlushDocs int
+	// FlushInterval 未达到上限时的发送间隔，默认 1 秒
+	FlushInterval time.Duration
+	// Workers 并发发送的 worker 数，默认 CPU 核数
+	Workers int
+	// MaxRetries 整个请求或单个文档返回 429 时的重试次数，默认 3；RetryBackoff 为首次重试的等待时间，之后翻倍
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// Refresh 为空时不刷新，可设为 true 或 wait_for；逐条刷新会拖垮集群，一般保持为空
+	Refresh string
+	// OnSuccess/OnFailure BulkItem 未设置回调时使用
+	OnSuccess func(BulkItem, BulkItemResponse)
+	OnFailure func(BulkItem, BulkItemResponse, error)
+}
+
+// BulkItem 一个文档操作。Body：index/create 为文档，update 为更新请求体，如 {"doc": {...}, "doc_as_upsert": true}，delete 不需要；
+// 可以是 []byte、string、io.Reader 或可 JSON 编码的值
+type BulkItem struct {
+	Action string
+	Index  string
+	ID     string
+	Body   interface{}
+	// OnSuccess/OnFailure 在 worker 中调用，不要阻塞；文档被拒绝时 err 为 *ESError，可用 IsConflict 等判断
+	OnSuccess func(BulkItem, BulkItemResponse)
+	OnFailure func(BulkItem, BulkItemResponse, error)
+}
+
+type BulkItemResponse struct {
+	Index   string      `json:"_index"`
+	ID      string      `json:"_id"`
+	Version int64       `json:"_version"`
+	Result  string      `json:"result"`
+	Status  int         `json:"status"`
+	Error   *ErrorCause `json:"error"`
+}
+
+// err 被拒绝的文档转换为 *ESError
+func (r BulkItemResponse) err() error {
+	e := &ESError{StatusCode: r.Status}
+	if r.Error != nil {
+		e.Type = r.Error.Type
+		e.Reason = r.Error.Reason
+		e.CausedBy = r.Error.CausedBy
+	}
+	return e
+}
+
+type BulkStats struct {
+	Added    uint64
+	Flushed  uint64
+	Failed   uint64
+	Requests uint64
+	Retried  uint64
+}
+
+// BulkIndexer 批量写入文档，Add 并发安全，用完必须 Close 以发送剩余的文档
+type BulkIndexer struct {
+	client *Client
+	config BulkConfig
+	queue  chan *bulkEntry
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+	stats  BulkStats
+}
+
+type bulkEntry struct {
+	item BulkItem
+	data []byte
+}
+
+func (c *Client) NewBulkIndexer(cfg BulkConfig) *BulkIndexer {
+	if cfg.FlushBytes <= 0 {
+		cfg.FlushBytes = defaultFlushBytes
+	}
+	if cfg.FlushDocs <= 0 {
+		cfg.FlushDocs = defaultFlushDocs
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultBulkRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	b := &BulkIndexer{
+		client: c,
+		config: cfg,
+		queue:  make(chan *bulkEntry, cfg.Workers),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		b.wg.Add(1)
+		go b.work()
+	}
+	return b
+}
+
+// NewBulkIndexer 使用默认连接
+func NewBulkIndexer(cfg BulkConfig) *BulkIndexer {
+	return defaultClient.NewBulkIndexer(cfg)
+}
+
+// Add 加入待发送队列，队列满时阻塞直到 ctx 结束
+func (b *BulkIndexer) Add(ctx context.Context, item BulkItem) error {
+	data, err := b.encode(item)
+	if err != nil {
+		return err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrBulkClosed
+	}
+	select {
+	case b.queue <- &bulkEntry{item: item, data: data}:
+		atomic.AddUint64(&b.stats.Added, 1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 发送剩余文档并等待所有 worker 结束，ctx 结束时不再等待，剩余文档仍会在后台发送
+func (b *BulkIndexer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *BulkIndexer) Stats() BulkStats {
+	return BulkStats{
+		Added:    atomic.LoadUint64(&b.stats.Added),
+		Flushed:  atomic.LoadUint64(&b.stats.Flushed),
+		Failed:   atomic.LoadUint64(&b.stats.Failed),
+		Requests: atomic.LoadUint64(&b.stats.Requests),
+		Retried:  atomic.LoadUint64(&b.stats.Retried),
+	}
+}
+
+// encode 生成 action 行和文档行
+func (b *BulkIndexer) encode(item BulkItem) ([]byte, error) {
+	switch item.Action {
+	case BulkIndex, BulkCreate, BulkUpdate, BulkDelete:
+	default:
+		return nil, errors.New("es: invalid bulk action " + item.Action)
+	}
+	index := item.Index
+	if index == "" {
+		index = b.config.Index
+	}
+	if index == "" {
+		return nil, errors.New("es: bulk item requires index")
+	}
+	if item.ID == "" && item.Action != BulkIndex {
+		return nil, errors.New("es: bulk " + item.Action + " requires id")
+	}
+	meta := map[string]string{"_index": index}
+	if item.ID != "" {
+		meta["_id"] = item.ID
+	}
+	line, err := json.Marshal(map[string]interface{}{item.Action: meta})
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(line)
+	buf.WriteByte('\n')
+	if item.Action == BulkDelete {
+		return buf.Bytes(), nil
+	}
+	body, err := requestBody(item.Body)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, errors.New("es: bulk " + item.Action + " requires body")
+	}
+	doc, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	// 文档必须在一行内
+	compact := bytes.NewBuffer(make([]byte, 0, len(doc)))
+	if err = json.Compact(compact, doc); err != nil {
+		return nil, err
+	}
+	buf.Write(compact.Bytes())
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func (b *BulkIndexer) work() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+	var (
+		batch []*bulkEntry
+		size  int
+	)
+	flush := func() {
+		if len(batch) > 0 {
+			b.flush(batch)
+		}
+		batch, size = nil, 0
+	}
+	for {
+		select {
+		case e, ok := <-b.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if size > 0 && size+len(e.data) > b.config.FlushBytes {
+				flush()
+			}
+			batch = append(batch, e)
+			size += len(e.data)
+			if len(batch) >= b.config.FlushDocs || size >= b.config.FlushBytes {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flush 发送一批文档，整个请求或单个文档返回 429 时等待后重试，其余结果交给回调
+func (b *BulkIndexer) flush(batch []*bulkEntry) {
+	for attempt := 0; len(batch) > 0; attempt++ {
+		if attempt > 0 {
+			atomic.AddUint64(&b.stats.Retried, uint64(len(batch)))
+			time.Sleep(b.backoff(attempt))
+		}
+		items, status, err := b.send(batch)
+		if status == http.StatusTooManyRequests && attempt < b.config.MaxRetries {
+			continue
+		}
+		if err != nil {
+			for _, e := range batch {
+				b.failure(e, BulkItemResponse{Status: status}, err)
+			}
+			return
+		}
+		var retry []*bulkEntry
+		for i, e := range batch {
+			res := items[i]
+			switch {
+			case res.Status == http.StatusTooManyRequests && attempt < b.config.MaxRetries:
+				retry = append(retry, e)
+			case res.Status >= 200 && res.Status < 300:
+				b.success(e, res)
+			default:
+				b.failure(e, res, res.err())
+			}
+		}
+		batch = retry
+	}
+}
+
+func (b *BulkIndexer) backoff(attempt int) time.Duration {
+	d := b.config.RetryBackoff << (attempt - 1)
+	if d <= 0 || d > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return d
+}
+
+// send 返回与 batch 一一对应的结果和 HTTP 状态码
+func (b *BulkIndexer) send(batch []*bulkEntry) ([]BulkItemResponse, int, error) {
+	var body bytes.Buffer
+	for _, e := range batch {
+		body.Write(e.data)
+	}
+	atomic.AddUint64(&b.stats.Requests, 1)
+	c := b.client
+	opts := []func(*esapi.BulkRequest){c.Bulk.WithContext(context.Background())}
+	if b.config.Refresh != "" {
+		opts = append(opts, c.Bulk.WithRefresh(b.config.Refresh))
+	}
+	res, err := c.Bulk(&body, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
+		return nil, res.StatusCode, err
+	}
+	var raw struct {
+		Items []map[string]BulkItemResponse `json:"items"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&raw); err != nil {
+		return nil, res.StatusCode, err
+	}
+	if len(raw.Items) != len(batch) {
+		return nil, res.StatusCode, fmt.Errorf("es bulk: %d items in response, %d sent", len(raw.Items), len(batch))
+	}
+	items := make([]BulkItemResponse, len(batch))
+	for i, item := range raw.Items {
+		for _, r := range item {
+			items[i] = r
+		}
+	}
+	return items, res.StatusCode, nil
+}
+
+func (b *BulkIndexer) success(e *bulkEntry, res BulkItemResponse) {
+	atomic.AddUint64(&b.stats.Flushed, 1)
+	if e.item.OnSuccess != nil {
+		e.item.OnSuccess(e.item, res)
+	} else if b.config.OnSuccess != nil {
+		b.config.OnSuccess(e.item, res)
+	}
+}
+
+func (b *BulkIndexer) failure(e *bulkEntry, res BulkItemResponse, err error) {
+	atomic.AddUint64(&b.stats.Failed, 1)
+	if e.item.OnFailure != nil {
+		e.item.OnFailure(e.item, res, err)
+	} else if b.config.OnFailure != nil {
+		b.config.OnFailure(e.item, res, err)
+	}
+}
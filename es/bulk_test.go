@@ -0,0 +1,44 @@
+package es
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBulkEncode(t *testing.T) {
+	b := &BulkIndexer{config: BulkConfig{Index: "logs"}}
+	tests := []struct {
+		name    string
+		item    BulkItem
+		want    string
+		wantErr bool
+	}{
+		{"index default index", BulkItem{Action: BulkIndex, Body: map[string]int{"a": 1}},
+			`{"index":{"_index":"logs"}}` + "\n" + `{"a":1}` + "\n", false},
+		{"create with id", BulkItem{Action: BulkCreate, Index: "users", ID: "1", Body: "{\n  \"name\": \"x\"\n}"},
+			`{"create":{"_id":"1","_index":"users"}}` + "\n" + `{"name":"x"}` + "\n", false},
+		{"update reader", BulkItem{Action: BulkUpdate, ID: "2", Body: strings.NewReader(`{"doc": {"n": 2}}`)},
+			`{"update":{"_id":"2","_index":"logs"}}` + "\n" + `{"doc":{"n":2}}` + "\n", false},
+		{"delete", BulkItem{Action: BulkDelete, ID: "3"},
+			`{"delete":{"_id":"3","_index":"logs"}}` + "\n", false},
+		{"invalid action", BulkItem{Action: "upsert", ID: "1"}, "", true},
+		{"delete without id", BulkItem{Action: BulkDelete}, "", true},
+		{"update without id", BulkItem{Action: BulkUpdate, Body: `{}`}, "", true},
+		{"index without body", BulkItem{Action: BulkIndex}, "", true},
+		{"invalid json", BulkItem{Action: BulkIndex, Body: []byte(`{`)}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := b.encode(tt.item)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: encode err = %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: encode = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := (&BulkIndexer{}).encode(BulkItem{Action: BulkIndex, Body: `{}`}); err == nil {
+		t.Error("encode without index succeeded")
+	}
+}
@@ -0,0 +1,116 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// ESError Elasticsearch 返回的错误响应。文档不存在等没有 error 字段的响应只有 StatusCode
+type ESError struct {
+	StatusCode   int
+	Type         string
+	Reason       string
+	RootCause    []ErrorCause
+	FailedShards []ShardFailure
+	CausedBy     *ErrorCause
+	// Body 原始响应体，最多保留 4KB
+	Body []byte
+}
+
+type ErrorCause struct {
+	Type     string      `json:"type"`
+	Reason   string      `json:"reason"`
+	Index    string      `json:"index"`
+	CausedBy *ErrorCause `json:"caused_by"`
+}
+
+type ShardFailure struct {
+	Shard  int        `json:"shard"`
+	Index  string     `json:"index"`
+	Node   string     `json:"node"`
+	Reason ErrorCause `json:"reason"`
+}
+
+func (e *ESError) Error() string {
+	switch {
+	case e.Type != "":
+		return fmt.Sprintf("es error %d %s: %s", e.StatusCode, e.Type, e.Reason)
+	case e.Reason != "":
+		return fmt.Sprintf("es error %d: %s", e.StatusCode, e.Reason)
+	}
+	return fmt.Sprintf("es error %d: %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// IsNotFound 文档或索引不存在
+func IsNotFound(err error) bool {
+	var e *ESError
+	return errors.As(err, &e) && (e.StatusCode == http.StatusNotFound || e.Type == "index_not_found_exception")
+}
+
+// IsConflict 版本冲突，如 create 已存在的文档或 if_seq_no 不匹配
+func IsConflict(err error) bool {
+	var e *ESError
+	return errors.As(err, &e) && (e.StatusCode == http.StatusConflict || e.Type == "version_conflict_engine_exception")
+}
+
+// IsTimeout Elasticsearch 返回的超时错误，也包括 ctx 超时和网络超时
+func IsTimeout(err error) bool {
+	var e *ESError
+	if errors.As(err, &e) {
+		return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusGatewayTimeout ||
+			strings.Contains(e.Type, "timeout")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// IsTooManyRequests 集群拒绝请求（429），稍后重试
+func IsTooManyRequests(err error) bool {
+	var e *ESError
+	return errors.As(err, &e) && e.StatusCode == http.StatusTooManyRequests
+}
+
+// decodeError 状态码小于 300 时返回 nil，否则读取响应体解析为 *ESError
+func decodeError(res *esapi.Response) error {
+	if !res.IsError() {
+		return nil
+	}
+	body, _ := io.ReadAll(res.Body)
+	e := &ESError{StatusCode: res.StatusCode, Body: body}
+	if len(body) > 4<<10 {
+		e.Body = body[:4<<10]
+	}
+	var raw struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &raw) != nil || len(raw.Error) == 0 {
+		return e
+	}
+	var detail struct {
+		ErrorCause
+		RootCause    []ErrorCause   `json:"root_cause"`
+		FailedShards []ShardFailure `json:"failed_shards"`
+	}
+	if json.Unmarshal(raw.Error, &detail) != nil {
+		// 部分接口的 error 是字符串
+		json.Unmarshal(raw.Error, &e.Reason)
+		return e
+	}
+	e.Type = detail.Type
+	e.Reason = detail.Reason
+	e.CausedBy = detail.CausedBy
+	e.RootCause = detail.RootCause
+	e.FailedShards = detail.FailedShards
+	return e
+}
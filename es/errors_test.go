@@ -0,0 +1,84 @@
+package es
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+func response(status int, body string) *esapi.Response {
+	return &esapi.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   *ESError
+	}{
+		{"ok", http.StatusOK, `{}`, nil},
+		{"not found without body", http.StatusNotFound, ``, &ESError{StatusCode: 404}},
+		{"error object", http.StatusBadRequest,
+			`{"error":{"type":"search_phase_execution_exception","reason":"all shards failed","root_cause":[{"type":"query_shard_exception","reason":"bad field"}],"caused_by":{"type":"x","reason":"y"}},"status":400}`,
+			&ESError{StatusCode: 400, Type: "search_phase_execution_exception", Reason: "all shards failed",
+				RootCause: []ErrorCause{{Type: "query_shard_exception", Reason: "bad field"}}, CausedBy: &ErrorCause{Type: "x", Reason: "y"}}},
+		{"error string", http.StatusInternalServerError, `{"error":"boom"}`, &ESError{StatusCode: 500, Reason: "boom"}},
+		{"not json", http.StatusBadGateway, `<html>`, &ESError{StatusCode: 502}},
+	}
+	for _, tt := range tests {
+		err := decodeError(response(tt.status, tt.body))
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: decodeError = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		e, ok := err.(*ESError)
+		if !ok {
+			t.Errorf("%s: decodeError = %T, want *ESError", tt.name, err)
+			continue
+		}
+		if e.StatusCode != tt.want.StatusCode || e.Type != tt.want.Type || e.Reason != tt.want.Reason ||
+			len(e.RootCause) != len(tt.want.RootCause) || (e.CausedBy == nil) != (tt.want.CausedBy == nil) {
+			t.Errorf("%s: decodeError = %+v, want %+v", tt.name, e, tt.want)
+		}
+		if string(e.Body) != tt.body {
+			t.Errorf("%s: Body = %q", tt.name, e.Body)
+		}
+	}
+}
+
+func TestDecodeErrorBodyLimit(t *testing.T) {
+	err := decodeError(response(http.StatusInternalServerError, strings.Repeat("x", 8<<10)))
+	if e := err.(*ESError); len(e.Body) != 4<<10 {
+		t.Fatalf("Body length = %d, want %d", len(e.Body), 4<<10)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		err                error
+		notFound, conflict bool
+		timeout, tooMany   bool
+	}{
+		{&ESError{StatusCode: 404}, true, false, false, false},
+		{&ESError{StatusCode: 400, Type: "index_not_found_exception"}, true, false, false, false},
+		{&ESError{StatusCode: 409}, false, true, false, false},
+		{&ESError{StatusCode: 504}, false, false, true, false},
+		{&ESError{StatusCode: 500, Type: "receive_timeout_transport_exception"}, false, false, true, false},
+		{&ESError{StatusCode: 429}, false, false, false, true},
+		{context.DeadlineExceeded, false, false, true, false},
+	}
+	for _, tt := range tests {
+		if IsNotFound(tt.err) != tt.notFound || IsConflict(tt.err) != tt.conflict ||
+			IsTimeout(tt.err) != tt.timeout || IsTooManyRequests(tt.err) != tt.tooMany {
+			t.Errorf("%v: got notFound=%v conflict=%v timeout=%v tooMany=%v", tt.err,
+				IsNotFound(tt.err), IsConflict(tt.err), IsTimeout(tt.err), IsTooManyRequests(tt.err))
+		}
+	}
+}
@@ -1,121 +1,202 @@
 package es
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"io"
 	"io/ioutil"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/zhaihao-zhugh/tools/es/query"
 )
 
-var es *elasticsearch.Client
+// Client 一个 Elasticsearch 集群的连接，多个集群时各自创建 Client
+type Client struct {
+	*elasticsearch.Client
+}
+
+// defaultClient 包级函数使用的连接，由 NewConnect 或 SetDefault 设置
+var defaultClient *Client
 
+// NewConnect 连接集群并设为默认连接
 func NewConnect(host []string) error {
-	cfg := elasticsearch.Config{
-		Addresses: host,
-	}
-	cli, err := elasticsearch.NewClient(cfg)
+	cli, err := NewClient(host)
 	if err != nil {
 		return err
 	}
-	es = cli
+	SetDefault(cli)
 	return nil
 }
 
+func NewClient(host []string) (*Client, error) {
+	return NewClientWithConfig(elasticsearch.Config{
+		Addresses: host,
+	})
+}
+
+// NewClientWithConfig 可通过 cfg.Transport 注入自定义的 http.RoundTripper，如测试用的假集群
+func NewClientWithConfig(cfg elasticsearch.Config) (*Client, error) {
+	cli, err := elasticsearch.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{cli}, nil
+}
+
+func Default() *Client {
+	return defaultClient
+}
+
+func SetDefault(c *Client) {
+	defaultClient = c
+}
+
 func HandleESDefine(index string, body io.Reader) (result []byte, err error) {
+	return defaultClient.HandleESDefine(index, body)
+}
+
+func HandleESCreate(index string, body io.Reader, id string) (result []byte, err error) {
+	return defaultClient.HandleESCreate(index, body, id)
+}
+
+func HandleESSearch(index string, body io.Reader) (result []byte, err error) {
+	return defaultClient.HandleESSearch(index, body)
+}
+
+func HandleESUpdate(index string, doc_id string, body io.Reader) (result []byte, err error) {
+	return defaultClient.HandleESUpdate(index, doc_id, body)
+}
+
+func HandleESUpdateByQuery(indexes []string, body io.Reader) (result []byte, err error) {
+	return defaultClient.HandleESUpdateByQuery(indexes, body)
+}
+
+func HandleESDeleteById(index string, doc_id string) (result []byte, err error) {
+	return defaultClient.HandleESDeleteById(index, doc_id)
+}
+
+func HandleESDeleteByQuery(indexes []string, body io.Reader) (result []byte, err error) {
+	return defaultClient.HandleESDeleteByQuery(indexes, body)
+}
+
+func HandleESGet(index string, doc_id string) (result []byte, err error) {
+	return defaultClient.HandleESGet(index, doc_id)
+}
+
+func HandleESState(index string, field string) (result []byte, err error) {
+	return defaultClient.HandleESState(index, field)
+}
+
+func HandleESCount(index string, body io.Reader) int {
+	return defaultClient.HandleESCount(index, body)
+}
+
+func HandleESCountContext(ctx context.Context, index string, body io.Reader) (int, error) {
+	return defaultClient.HandleESCountContext(ctx, index, body)
+}
+
+func IsHaveValue(index string, field string, value string) bool {
+	return defaultClient.IsHaveValue(index, field, value)
+}
+
+func (c *Client) HandleESDefine(index string, body io.Reader) (result []byte, err error) {
 	req := esapi.IndicesCreateRequest{
 		Index: index, // Index name
 		Body:  body,  // Document body
 	}
-	res, e := req.Do(context.Background(), es)
+	res, e := req.Do(context.Background(), c)
 	if e != nil {
 		err = e
 		return
 	}
-	result, err = ioutil.ReadAll(res.Body)
 	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
+		return
+	}
+	result, err = ioutil.ReadAll(res.Body)
 	return
 }
 
-func HandleESCreate(index string, body io.Reader, id string) (result []byte, err error) {
-	res, e := es.Index(
-		index,                        // Index name
-		body,                         // Document body
-		es.Index.WithDocumentID(id),  // Document ID
-		es.Index.WithRefresh("true"), // Refresh
+func (c *Client) HandleESCreate(index string, body io.Reader, id string) (result []byte, err error) {
+	res, e := c.Index(
+		index,                       // Index name
+		body,                        // Document body
+		c.Index.WithDocumentID(id),  // Document ID
+		c.Index.WithRefresh("true"), // Refresh
 	)
 	if e != nil {
 		err = e
 		return
 	}
-	result, err = ioutil.ReadAll(res.Body)
 	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
+		return
+	}
+	result, err = ioutil.ReadAll(res.Body)
 	return
 }
 
-func HandleESSearch(index string, body io.Reader) (result []byte, err error) {
-	res, e := es.Search(
-		es.Search.WithContext(context.Background()),
-		es.Search.WithIndex(index),
-		es.Search.WithBody(body),
-		es.Search.WithTrackTotalHits(true),
-		es.Search.WithPretty(),
+func (c *Client) HandleESSearch(index string, body io.Reader) (result []byte, err error) {
+	res, e := c.Search(
+		c.Search.WithContext(context.Background()),
+		c.Search.WithIndex(index),
+		c.Search.WithBody(body),
+		c.Search.WithTrackTotalHits(true),
+		c.Search.WithPretty(),
 	)
 	if e != nil {
 		err = e
 		return
 	}
-	result, err = ioutil.ReadAll(res.Body)
 	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
+		return
+	}
+	result, err = ioutil.ReadAll(res.Body)
 	return
 }
 
-func HandleESUpdate(index string, doc_id string, body io.Reader) (result []byte, err error) {
-	res, e := es.Update(
+func (c *Client) HandleESUpdate(index string, doc_id string, body io.Reader) (result []byte, err error) {
+	res, e := c.Update(
 		index,
 		doc_id,
 		body,
-		es.Update.WithRefresh(`true`),
-		es.Update.WithPretty(),
+		c.Update.WithRefresh(`true`),
+		c.Update.WithPretty(),
 	)
 	if e != nil {
 		err = e
 		return
 	}
-	if res.StatusCode != 200 {
-		err = errors.New("es update fail")
+	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
 		return
 	}
 	result, err = ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
 	return
 }
 
-func HandleESUpdateByQuery(indexes []string, body io.Reader) (result []byte, err error) {
-	res, e := es.UpdateByQuery(
+func (c *Client) HandleESUpdateByQuery(indexes []string, body io.Reader) (result []byte, err error) {
+	res, e := c.UpdateByQuery(
 		indexes,
-		es.UpdateByQuery.WithBody(body),
-		es.UpdateByQuery.WithRefresh(true),
+		c.UpdateByQuery.WithBody(body),
+		c.UpdateByQuery.WithRefresh(true),
 	)
 	if e != nil {
 		err = e
 		return
 	}
-	if res.StatusCode != 200 {
-		err = errors.New("es update fail")
+	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
 		return
 	}
 	result, err = ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
 	return
 }
 
-func HandleESDeleteById(index string, doc_id string) (result []byte, err error) {
-	res, e := es.Delete(
+func (c *Client) HandleESDeleteById(index string, doc_id string) (result []byte, err error) {
+	res, e := c.Delete(
 		index,
 		doc_id,
 	)
@@ -123,17 +204,16 @@ func HandleESDeleteById(index string, doc_id string) (result []byte, err error)
 		err = e
 		return
 	}
-	if res.StatusCode != 200 {
-		err = errors.New("es delete fail")
+	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
 		return
 	}
 	result, err = ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
 	return
 }
 
-func HandleESDeleteByQuery(indexes []string, body io.Reader) (result []byte, err error) {
-	res, e := es.DeleteByQuery(
+func (c *Client) HandleESDeleteByQuery(indexes []string, body io.Reader) (result []byte, err error) {
+	res, e := c.DeleteByQuery(
 		indexes,
 		body,
 	)
@@ -141,97 +221,83 @@ func HandleESDeleteByQuery(indexes []string, body io.Reader) (result []byte, err
 		err = e
 		return
 	}
-	if res.StatusCode != 200 {
-		err = errors.New("es delete fail")
+	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
 		return
 	}
 	result, err = ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
 	return
 }
 
-func HandleESGet(index string, doc_id string) (result []byte, err error) {
-	res, e := es.Get(
+func (c *Client) HandleESGet(index string, doc_id string) (result []byte, err error) {
+	res, e := c.Get(
 		index,
 		doc_id,
-		es.Get.WithPretty(),
+		c.Get.WithPretty(),
 	)
 	if e != nil {
 		err = e
 		return
 	}
-	if res.StatusCode != 200 {
-		err = errors.New("no data")
+	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
 		return
 	}
 	result, err = ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
 	return
 }
 
-func HandleESState(index string, field string) (result []byte, err error) {
-	res, e := es.Indices.Stats(
-		es.Indices.Stats.WithIndex(index),
-		es.Indices.Stats.WithMetric(field),
+func (c *Client) HandleESState(index string, field string) (result []byte, err error) {
+	res, e := c.Indices.Stats(
+		c.Indices.Stats.WithIndex(index),
+		c.Indices.Stats.WithMetric(field),
 	)
 	if e != nil {
 		err = e
 		return
 	}
-	if res.StatusCode != 200 {
-		err = errors.New("status code error")
+	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
 		return
 	}
 	result, err = ioutil.ReadAll(res.Body)
-	defer res.Body.Close()
 	return
 }
 
-func HandleESCount(index string, body io.Reader) int {
-	var res *esapi.Response
-	var err error
+// HandleESCount 出错时返回 0，需要区分错误时使用 HandleESCountContext
+func (c *Client) HandleESCount(index string, body io.Reader) int {
+	count, _ := c.HandleESCountContext(context.Background(), index, body)
+	return count
+}
+
+func (c *Client) HandleESCountContext(ctx context.Context, index string, body io.Reader) (int, error) {
+	opts := []func(*esapi.CountRequest){
+		c.Count.WithContext(ctx),
+		c.Count.WithIndex(index),
+	}
 	if body != nil {
-		res, err = es.Count(
-			es.Count.WithContext(context.Background()),
-			es.Count.WithIndex(index),
-			es.Count.WithBody(body),
-			es.Count.WithPretty(),
-		)
-	} else {
-		res, err = es.Count(
-			es.Count.WithContext(context.Background()),
-			es.Count.WithIndex(index),
-			es.Count.WithPretty(),
-		)
+		opts = append(opts, c.Count.WithBody(body))
 	}
+	res, err := c.Count(opts...)
 	if err != nil {
-		return 0
+		return 0, err
 	}
-	res_body, err := ioutil.ReadAll(res.Body)
 	defer res.Body.Close()
-	if err != nil {
-		return 0
+	if err = decodeError(res); err != nil {
+		return 0, err
 	}
-	result := make(map[string]interface{})
-	json.Unmarshal(res_body, &result)
-
-	if count, ok := result["count"].(float64); ok {
-		return int(count)
+	var result struct {
+		Count int `json:"count"`
 	}
-	return 0
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.Count, nil
 }
 
-func IsHaveValue(index string, field string, value string) bool {
-	req := map[string]interface{}{
-		"query": map[string]interface{}{
-			"match": map[string]interface{}{
-				field: value,
-			},
-		},
-	}
-	req_json, _ := json.Marshal(req)
-	body := bytes.NewBuffer(req_json)
-	count := HandleESCount(index, body)
+func (c *Client) IsHaveValue(index string, field string, value string) bool {
+	body := query.NewSearch().Query(query.Match(field, value)).Reader()
+	count := c.HandleESCount(index, body)
 	if count > 0 {
 		return true
 	}
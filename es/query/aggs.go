@@ -0,0 +1,169 @@
+package query
+
+// Aggregation 聚合，Source 返回对应的 DSL 结构
+type Aggregation interface {
+	Source() map[string]interface{}
+}
+
+func aggSources(aggs map[string]Aggregation) map[string]interface{} {
+	out := make(map[string]interface{}, len(aggs))
+	for name, a := range aggs {
+		out[name] = a.Source()
+	}
+	return out
+}
+
+// bucketAgg 分桶聚合的公共部分，可以嵌套子聚合
+type bucketAgg struct {
+	kind string
+	body map[string]interface{}
+	subs map[string]Aggregation
+}
+
+func (a *bucketAgg) source() map[string]interface{} {
+	s := map[string]interface{}{a.kind: a.body}
+	if len(a.subs) > 0 {
+		s["aggs"] = aggSources(a.subs)
+	}
+	return s
+}
+
+func (a *bucketAgg) sub(name string, agg Aggregation) {
+	if a.subs == nil {
+		a.subs = map[string]Aggregation{}
+	}
+	a.subs[name] = agg
+}
+
+type TermsAggregation struct {
+	bucketAgg
+}
+
+// TermsAgg 按字段值分桶，text 字段需使用 keyword 子字段
+func TermsAgg(field string) *TermsAggregation {
+	return &TermsAggregation{bucketAgg{kind: "terms", body: map[string]interface{}{"field": field}}}
+}
+
+func (a *TermsAggregation) Size(size int) *TermsAggregation {
+	a.body["size"] = size
+	return a
+}
+
+func (a *TermsAggregation) MinDocCount(n int) *TermsAggregation {
+	a.body["min_doc_count"] = n
+	return a
+}
+
+// Order 按 _count、_key 或子聚合名排序，如 Order("_count", false)
+func (a *TermsAggregation) Order(key string, asc bool) *TermsAggregation {
+	a.body["order"] = map[string]interface{}{key: direction(asc)}
+	return a
+}
+
+func (a *TermsAggregation) Missing(v interface{}) *TermsAggregation {
+	a.body["missing"] = v
+	return a
+}
+
+func (a *TermsAggregation) SubAgg(name string, agg Aggregation) *TermsAggregation {
+	a.sub(name, agg)
+	return a
+}
+
+func (a *TermsAggregation) Source() map[string]interface{} {
+	return a.source()
+}
+
+type DateHistogramAggregation struct {
+	bucketAgg
+}
+
+func DateHistogramAgg(field string) *DateHistogramAggregation {
+	return &DateHistogramAggregation{bucketAgg{kind: "date_histogram", body: map[string]interface{}{"field": field}}}
+}
+
+// CalendarInterval 日历间隔：minute、hour、day、week、month、quarter、year 或 1d 等
+func (a *DateHistogramAggregation) CalendarInterval(interval string) *DateHistogramAggregation {
+	a.body["calendar_interval"] = interval
+	return a
+}
+
+// FixedInterval 固定间隔，如 30m、12h
+func (a *DateHistogramAggregation) FixedInterval(interval string) *DateHistogramAggregation {
+	a.body["fixed_interval"] = interval
+	return a
+}
+
+// Format 桶 key_as_string 的格式
+func (a *DateHistogramAggregation) Format(format string) *DateHistogramAggregation {
+	a.body["format"] = format
+	return a
+}
+
+func (a *DateHistogramAggregation) TimeZone(tz string) *DateHistogramAggregation {
+	a.body["time_zone"] = tz
+	return a
+}
+
+func (a *DateHistogramAggregation) MinDocCount(n int) *DateHistogramAggregation {
+	a.body["min_doc_count"] = n
+	return a
+}
+
+// ExtendedBounds 没有数据的区间也返回空桶，需配合 MinDocCount(0)
+func (a *DateHistogramAggregation) ExtendedBounds(min, max interface{}) *DateHistogramAggregation {
+	a.body["extended_bounds"] = map[string]interface{}{"min": min, "max": max}
+	return a
+}
+
+func (a *DateHistogramAggregation) SubAgg(name string, agg Aggregation) *DateHistogramAggregation {
+	a.sub(name, agg)
+	return a
+}
+
+func (a *DateHistogramAggregation) Source() map[string]interface{} {
+	return a.source()
+}
+
+// MetricAggregation stats、avg、sum 等单字段指标聚合
+type MetricAggregation struct {
+	kind string
+	body map[string]interface{}
+}
+
+func metricAgg(kind string, field string) *MetricAggregation {
+	return &MetricAggregation{kind: kind, body: map[string]interface{}{"field": field}}
+}
+
+func StatsAgg(field string) *MetricAggregation {
+	return metricAgg("stats", field)
+}
+
+func AvgAgg(field string) *MetricAggregation {
+	return metricAgg("avg", field)
+}
+
+func SumAgg(field string) *MetricAggregation {
+	return metricAgg("sum", field)
+}
+
+func MinAgg(field string) *MetricAggregation {
+	return metricAgg("min", field)
+}
+
+func MaxAgg(field string) *MetricAggregation {
+	return metricAgg("max", field)
+}
+
+func CardinalityAgg(field string) *MetricAggregation {
+	return metricAgg("cardinality", field)
+}
+
+func (a *MetricAggregation) Missing(v interface{}) *MetricAggregation {
+	a.body["missing"] = v
+	return a
+}
+
+func (a *MetricAggregation) Source() map[string]interface{} {
+	return map[string]interface{}{a.kind: a.body}
+}
@@ -0,0 +1,255 @@
+// Package query 构造 Elasticsearch 查询 DSL，生成的请求体可直接传给 es.HandleESSearch、es.HandleESCount 和 es.Search
+package query
+
+import "encoding/json"
+
+// Query 查询子句，Source 返回对应的 DSL 结构
+type Query interface {
+	Source() map[string]interface{}
+}
+
+func sources(list []Query) []interface{} {
+	out := make([]interface{}, len(list))
+	for i, q := range list {
+		out[i] = q.Source()
+	}
+	return out
+}
+
+// BoolQuery bool 组合查询：Must/Should 参与评分，Filter/MustNot 只过滤
+type BoolQuery struct {
+	must, should, filter, mustNot []Query
+	minimumShouldMatch            interface{}
+	boost                         *float64
+}
+
+func Bool() *BoolQuery {
+	return &BoolQuery{}
+}
+
+func (q *BoolQuery) Must(list ...Query) *BoolQuery {
+	q.must = append(q.must, list...)
+	return q
+}
+
+func (q *BoolQuery) Should(list ...Query) *BoolQuery {
+	q.should = append(q.should, list...)
+	return q
+}
+
+func (q *BoolQuery) Filter(list ...Query) *BoolQuery {
+	q.filter = append(q.filter, list...)
+	return q
+}
+
+func (q *BoolQuery) MustNot(list ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, list...)
+	return q
+}
+
+// MinimumShouldMatch 数量（如 1）或百分比（如 "75%"）
+func (q *BoolQuery) MinimumShouldMatch(v interface{}) *BoolQuery {
+	q.minimumShouldMatch = v
+	return q
+}
+
+func (q *BoolQuery) Boost(boost float64) *BoolQuery {
+	q.boost = &boost
+	return q
+}
+
+func (q *BoolQuery) Source() map[string]interface{} {
+	b := map[string]interface{}{}
+	if len(q.must) > 0 {
+		b["must"] = sources(q.must)
+	}
+	if len(q.should) > 0 {
+		b["should"] = sources(q.should)
+	}
+	if len(q.filter) > 0 {
+		b["filter"] = sources(q.filter)
+	}
+	if len(q.mustNot) > 0 {
+		b["must_not"] = sources(q.mustNot)
+	}
+	if q.minimumShouldMatch != nil {
+		b["minimum_should_match"] = q.minimumShouldMatch
+	}
+	if q.boost != nil {
+		b["boost"] = *q.boost
+	}
+	return map[string]interface{}{"bool": b}
+}
+
+// rawQuery 固定结构的查询
+type rawQuery map[string]interface{}
+
+func (q rawQuery) Source() map[string]interface{} {
+	return q
+}
+
+// Raw 使用 builder 未覆盖的查询，如 Raw(map[string]interface{}{"wildcard": ...})
+func Raw(q map[string]interface{}) Query {
+	return rawQuery(q)
+}
+
+func MatchAll() Query {
+	return rawQuery{"match_all": map[string]interface{}{}}
+}
+
+// Term 精确匹配，用于 keyword、数字、日期等不分词的字段
+func Term(field string, value interface{}) Query {
+	return rawQuery{"term": map[string]interface{}{field: value}}
+}
+
+func Terms(field string, values ...interface{}) Query {
+	return rawQuery{"terms": map[string]interface{}{field: values}}
+}
+
+func Exists(field string) Query {
+	return rawQuery{"exists": map[string]interface{}{"field": field}}
+}
+
+func IDs(ids ...string) Query {
+	return rawQuery{"ids": map[string]interface{}{"values": ids}}
+}
+
+// MatchQuery 全文匹配
+type MatchQuery struct {
+	field string
+	body  map[string]interface{}
+}
+
+func Match(field string, text interface{}) *MatchQuery {
+	return &MatchQuery{field: field, body: map[string]interface{}{"query": text}}
+}
+
+// Operator or（默认）或 and
+func (q *MatchQuery) Operator(op string) *MatchQuery {
+	q.body["operator"] = op
+	return q
+}
+
+func (q *MatchQuery) Fuzziness(v string) *MatchQuery {
+	q.body["fuzziness"] = v
+	return q
+}
+
+func (q *MatchQuery) MinimumShouldMatch(v interface{}) *MatchQuery {
+	q.body["minimum_should_match"] = v
+	return q
+}
+
+func (q *MatchQuery) Boost(boost float64) *MatchQuery {
+	q.body["boost"] = boost
+	return q
+}
+
+func (q *MatchQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"match": map[string]interface{}{q.field: q.body}}
+}
+
+type MultiMatchQuery struct {
+	body map[string]interface{}
+}
+
+// MultiMatch 在多个字段上匹配，字段可带权重，如 "title^2"
+func MultiMatch(text interface{}, fields ...string) *MultiMatchQuery {
+	return &MultiMatchQuery{body: map[string]interface{}{"query": text, "fields": fields}}
+}
+
+// Type best_fields（默认）、most_fields、cross_fields、phrase、phrase_prefix 或 bool_prefix
+func (q *MultiMatchQuery) Type(t string) *MultiMatchQuery {
+	q.body["type"] = t
+	return q
+}
+
+func (q *MultiMatchQuery) Operator(op string) *MultiMatchQuery {
+	q.body["operator"] = op
+	return q
+}
+
+func (q *MultiMatchQuery) Fuzziness(v string) *MultiMatchQuery {
+	q.body["fuzziness"] = v
+	return q
+}
+
+func (q *MultiMatchQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"multi_match": q.body}
+}
+
+// RangeQuery 范围查询，time.Time 按 RFC3339 编码，也可使用 "now-1d/d" 等日期表达式
+type RangeQuery struct {
+	field string
+	body  map[string]interface{}
+}
+
+func Range(field string) *RangeQuery {
+	return &RangeQuery{field: field, body: map[string]interface{}{}}
+}
+
+func (q *RangeQuery) Gt(v interface{}) *RangeQuery {
+	q.body["gt"] = v
+	return q
+}
+
+func (q *RangeQuery) Gte(v interface{}) *RangeQuery {
+	q.body["gte"] = v
+	return q
+}
+
+func (q *RangeQuery) Lt(v interface{}) *RangeQuery {
+	q.body["lt"] = v
+	return q
+}
+
+func (q *RangeQuery) Lte(v interface{}) *RangeQuery {
+	q.body["lte"] = v
+	return q
+}
+
+// Format 日期字符串的格式，如 "yyyy-MM-dd HH:mm:ss"
+func (q *RangeQuery) Format(format string) *RangeQuery {
+	q.body["format"] = format
+	return q
+}
+
+// TimeZone 日期字符串和日期表达式的时区，如 "+08:00"
+func (q *RangeQuery) TimeZone(tz string) *RangeQuery {
+	q.body["time_zone"] = tz
+	return q
+}
+
+func (q *RangeQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"range": map[string]interface{}{q.field: q.body}}
+}
+
+// NestedQuery 查询 nested 类型字段，q 中的字段名需带 path 前缀
+type NestedQuery struct {
+	body map[string]interface{}
+}
+
+func Nested(path string, q Query) *NestedQuery {
+	return &NestedQuery{body: map[string]interface{}{"path": path, "query": q.Source()}}
+}
+
+// ScoreMode avg（默认）、max、min、sum 或 none
+func (q *NestedQuery) ScoreMode(mode string) *NestedQuery {
+	q.body["score_mode"] = mode
+	return q
+}
+
+func (q *NestedQuery) IgnoreUnmapped(ignore bool) *NestedQuery {
+	q.body["ignore_unmapped"] = ignore
+	return q
+}
+
+func (q *NestedQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"nested": q.body}
+}
+
+// JSON 查询子句的 JSON，调试用
+func JSON(q Query) string {
+	data, _ := json.Marshal(q.Source())
+	return string(data)
+}
@@ -0,0 +1,55 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestQueryJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		q    Query
+		want string
+	}{
+		{"match all", MatchAll(), `{"match_all":{}}`},
+		{"term", Term("status", "ok"), `{"term":{"status":"ok"}}`},
+		{"terms", Terms("id", 1, 2), `{"terms":{"id":[1,2]}}`},
+		{"exists", Exists("tags"), `{"exists":{"field":"tags"}}`},
+		{"match", Match("title", "hello").Operator("and"), `{"match":{"title":{"operator":"and","query":"hello"}}}`},
+		{"range", Range("age").Gte(18).Lt(60), `{"range":{"age":{"gte":18,"lt":60}}}`},
+		{"nested", Nested("items", Term("items.sku", "a")).ScoreMode("max"),
+			`{"nested":{"path":"items","query":{"term":{"items.sku":"a"}},"score_mode":"max"}}`},
+		{"empty bool", Bool(), `{"bool":{}}`},
+		{"bool", Bool().Must(Match("title", "go")).Filter(Term("status", "ok")).MustNot(Exists("deleted")).MinimumShouldMatch(1),
+			`{"bool":{"filter":[{"term":{"status":"ok"}}],"minimum_should_match":1,"must":[{"match":{"title":{"query":"go"}}}],"must_not":[{"exists":{"field":"deleted"}}]}}`},
+	}
+	for _, tt := range tests {
+		if got := JSON(tt.q); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSearchJSON(t *testing.T) {
+	s := NewSearch().
+		Query(Term("status", "ok")).
+		Sort("created", false).
+		Page(3, 20).
+		Includes("id", "title").
+		Agg("by_day", DateHistogramAgg("created").CalendarInterval("day").SubAgg("latency", StatsAgg("latency"))).
+		Agg("top", TermsAgg("user").Size(5))
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"_source":["id","title"],` +
+		`"aggs":{"by_day":{"aggs":{"latency":{"stats":{"field":"latency"}}},"date_histogram":{"calendar_interval":"day","field":"created"}},"top":{"terms":{"field":"user","size":5}}},` +
+		`"from":40,"query":{"term":{"status":"ok"}},"size":20,"sort":[{"created":{"order":"desc"}}]}`
+	if string(data) != want {
+		t.Fatalf("\n got %s\nwant %s", data, want)
+	}
+
+	if got, _ := json.Marshal(NewSearch().Page(0, 10)); string(got) != `{"from":0,"size":10}` {
+		t.Fatalf("Page(0) = %s", got)
+	}
+}
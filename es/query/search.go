@@ -0,0 +1,114 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// SearchSource 完整的请求体：查询、排序、分页和聚合
+type SearchSource struct {
+	query       Query
+	sort        []interface{}
+	from        *int
+	size        *int
+	searchAfter []interface{}
+	source      []string
+	aggs        map[string]Aggregation
+}
+
+func NewSearch() *SearchSource {
+	return &SearchSource{}
+}
+
+func (s *SearchSource) Query(q Query) *SearchSource {
+	s.query = q
+	return s
+}
+
+// Sort 按字段排序，可多次调用添加次级排序
+func (s *SearchSource) Sort(field string, asc bool) *SearchSource {
+	s.sort = append(s.sort, map[string]interface{}{field: map[string]interface{}{"order": direction(asc)}})
+	return s
+}
+
+func (s *SearchSource) From(from int) *SearchSource {
+	s.from = &from
+	return s
+}
+
+func (s *SearchSource) Size(size int) *SearchSource {
+	s.size = &size
+	return s
+}
+
+// Page 第 page 页（从 1 开始），每页 size 条；深度翻页使用 SearchAfter
+func (s *SearchSource) Page(page, size int) *SearchSource {
+	if page < 1 {
+		page = 1
+	}
+	return s.From((page - 1) * size).Size(size)
+}
+
+// SearchAfter 上一页最后一条命中的排序值，需配合 Sort 使用
+func (s *SearchSource) SearchAfter(values ...interface{}) *SearchSource {
+	s.searchAfter = values
+	return s
+}
+
+// Includes 只返回 _source 中的这些字段
+func (s *SearchSource) Includes(fields ...string) *SearchSource {
+	s.source = fields
+	return s
+}
+
+func (s *SearchSource) Agg(name string, agg Aggregation) *SearchSource {
+	if s.aggs == nil {
+		s.aggs = map[string]Aggregation{}
+	}
+	s.aggs[name] = agg
+	return s
+}
+
+func (s *SearchSource) Source() map[string]interface{} {
+	body := map[string]interface{}{}
+	if s.query != nil {
+		body["query"] = s.query.Source()
+	}
+	if len(s.sort) > 0 {
+		body["sort"] = s.sort
+	}
+	if s.from != nil {
+		body["from"] = *s.from
+	}
+	if s.size != nil {
+		body["size"] = *s.size
+	}
+	if len(s.searchAfter) > 0 {
+		body["search_after"] = s.searchAfter
+	}
+	if s.source != nil {
+		body["_source"] = s.source
+	}
+	if len(s.aggs) > 0 {
+		body["aggs"] = aggSources(s.aggs)
+	}
+	return body
+}
+
+func (s *SearchSource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Source())
+}
+
+// Reader 请求体，用于 es.HandleESSearch；es.HandleESCount 只接受 query，不能设置排序、分页和聚合
+func (s *SearchSource) Reader() io.Reader {
+	data, _ := json.Marshal(s.Source())
+	return bytes.NewReader(data)
+}
+
+func direction(asc bool) string {
+	if asc {
+		return "asc"
+	}
+	return "desc"
+}
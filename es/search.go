@@ -0,0 +1,138 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// SearchResult Search 解码后的结果，Hits 的 _source 解码为 T
+type SearchResult[T any] struct {
+	Took     int
+	TimedOut bool
+	// Total 命中总数，TotalRelation 为 gte 时 Total 是下限
+	Total         int64
+	TotalRelation string
+	MaxScore      *float64
+	Hits          []Hit[T]
+	Aggregations  Aggregations
+}
+
+type Hit[T any] struct {
+	Index string
+	ID    string
+	// Score 按字段排序时为空
+	Score     *float64
+	Source    T
+	Highlight map[string][]string
+	// Sort 排序值，可用于 search_after 翻页
+	Sort []interface{}
+}
+
+// Sources 返回所有命中的 _source
+func (r *SearchResult[T]) Sources() []T {
+	list := make([]T, len(r.Hits))
+	for i := range r.Hits {
+		list[i] = r.Hits[i].Source
+	}
+	return list
+}
+
+type searchResponse[T any] struct {
+	Took     int  `json:"took"`
+	TimedOut bool `json:"timed_out"`
+	Hits     struct {
+		Total struct {
+			Value    int64  `json:"value"`
+			Relation string `json:"relation"`
+		} `json:"total"`
+		MaxScore *float64 `json:"max_score"`
+		Hits     []struct {
+			Index     string              `json:"_index"`
+			ID        string              `json:"_id"`
+			Score     *float64            `json:"_score"`
+			Source    T                   `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+			Sort      []interface{}       `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations Aggregations `json:"aggregations"`
+}
+
+// Search 使用默认连接查询，query 可以是 io.Reader、[]byte、string 或可 JSON 编码的值
+func Search[T any](ctx context.Context, index string, query interface{}) (*SearchResult[T], error) {
+	return SearchWith[T](ctx, defaultClient, index, query)
+}
+
+// SearchWith 使用指定连接查询，index 可以是逗号分隔的多个索引
+func SearchWith[T any](ctx context.Context, c *Client, index string, query interface{}) (*SearchResult[T], error) {
+	body, err := requestBody(query)
+	if err != nil {
+		return nil, err
+	}
+	opts := []func(*esapi.SearchRequest){
+		c.Search.WithContext(ctx),
+		c.Search.WithTrackTotalHits(true),
+	}
+	if index != "" {
+		opts = append(opts, c.Search.WithIndex(strings.Split(index, ",")...))
+	}
+	if body != nil {
+		opts = append(opts, c.Search.WithBody(body))
+	}
+	res, err := c.Search(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if err = decodeError(res); err != nil {
+		return nil, err
+	}
+	var raw searchResponse[T]
+	if err = json.NewDecoder(res.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	result := &SearchResult[T]{
+		Took:          raw.Took,
+		TimedOut:      raw.TimedOut,
+		Total:         raw.Hits.Total.Value,
+		TotalRelation: raw.Hits.Total.Relation,
+		MaxScore:      raw.Hits.MaxScore,
+		Hits:          make([]Hit[T], len(raw.Hits.Hits)),
+		Aggregations:  raw.Aggregations,
+	}
+	for i, h := range raw.Hits.Hits {
+		result.Hits[i] = Hit[T]{
+			Index:     h.Index,
+			ID:        h.ID,
+			Score:     h.Score,
+			Source:    h.Source,
+			Highlight: h.Highlight,
+			Sort:      h.Sort,
+		}
+	}
+	return result, nil
+}
+
+// requestBody 把查询转换为请求体，nil 表示没有请求体
+func requestBody(query interface{}) (io.Reader, error) {
+	switch q := query.(type) {
+	case nil:
+		return nil, nil
+	case io.Reader:
+		return q, nil
+	case []byte:
+		return bytes.NewReader(q), nil
+	case string:
+		return strings.NewReader(q), nil
+	}
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
@@ -0,0 +1,125 @@
+package es
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// fakeTransport 返回固定响应并记录最后一次请求
+type fakeTransport struct {
+	status int
+	body   string
+	req    *http.Request
+	sent   string
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.req = req
+	if req.Body != nil {
+		data, _ := io.ReadAll(req.Body)
+		f.sent = string(data)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Elastic-Product", "Elasticsearch")
+	return &http.Response{
+		StatusCode: f.status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(f.body)),
+		Request:    req,
+	}, nil
+}
+
+func fakeClient(t *testing.T, status int, body string) (*Client, *fakeTransport) {
+	t.Helper()
+	tr := &fakeTransport{status: status, body: body}
+	c, err := NewClientWithConfig(elasticsearch.Config{Addresses: []string{"http://es.test:9200"}, Transport: tr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, tr
+}
+
+type user struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+const searchResponseBody = `{
+	"took": 5,
+	"timed_out": false,
+	"hits": {
+		"total": {"value": 10000, "relation": "gte"},
+		"max_score": 1.5,
+		"hits": [
+			{"_index": "users-1", "_id": "1", "_score": 1.5, "_source": {"name": "alice", "age": 30},
+			 "highlight": {"name": ["<em>alice</em>"]}},
+			{"_index": "users-2", "_id": "2", "_score": null, "_source": {"name": "bob", "age": 25}, "sort": [25, "2"]}
+		]
+	},
+	"aggregations": {"ages": {"value": 27.5}}
+}`
+
+func TestSearchWith(t *testing.T) {
+	c, tr := fakeClient(t, http.StatusOK, searchResponseBody)
+	res, err := SearchWith[user](context.Background(), c, "users-1,users-2", `{"query":{"match_all":{}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tr.req.URL.Path != "/users-1,users-2/_search" {
+		t.Errorf("path = %s", tr.req.URL.Path)
+	}
+	if tr.req.URL.Query().Get("track_total_hits") != "true" {
+		t.Errorf("query = %s, want track_total_hits=true", tr.req.URL.RawQuery)
+	}
+	if tr.sent != `{"query":{"match_all":{}}}` {
+		t.Errorf("body = %s", tr.sent)
+	}
+
+	if res.Took != 5 || res.Total != 10000 || res.TotalRelation != "gte" || res.MaxScore == nil || *res.MaxScore != 1.5 {
+		t.Fatalf("result = %+v", res)
+	}
+	if len(res.Hits) != 2 {
+		t.Fatalf("hits = %d, want 2", len(res.Hits))
+	}
+	alice, bob := res.Hits[0], res.Hits[1]
+	if alice.Index != "users-1" || alice.ID != "1" || alice.Score == nil || *alice.Score != 1.5 || alice.Source != (user{"alice", 30}) {
+		t.Errorf("hit 0 = %+v", alice)
+	}
+	if h := alice.Highlight["name"]; len(h) != 1 || h[0] != "<em>alice</em>" {
+		t.Errorf("highlight = %v", alice.Highlight)
+	}
+	if bob.Score != nil || len(bob.Sort) != 2 || bob.Sort[1] != "2" {
+		t.Errorf("hit 1 = %+v", bob)
+	}
+	if got := res.Sources(); len(got) != 2 || got[1].Name != "bob" {
+		t.Errorf("Sources = %v", got)
+	}
+	if v, ok := res.Aggregations.Value("ages"); !ok || v == nil || *v != 27.5 {
+		t.Errorf("aggregation = %v, %v", v, ok)
+	}
+}
+
+func TestSearchWithError(t *testing.T) {
+	c, _ := fakeClient(t, http.StatusNotFound,
+		`{"error":{"type":"index_not_found_exception","reason":"no such index [users]","index":"users"},"status":404}`)
+	_, err := SearchWith[user](context.Background(), c, "users", map[string]interface{}{"size": 1})
+	if !IsNotFound(err) {
+		t.Fatalf("err = %v, want not found", err)
+	}
+	e := err.(*ESError)
+	if e.Type != "index_not_found_exception" || e.Reason != "no such index [users]" {
+		t.Fatalf("err = %+v", e)
+	}
+
+	c, _ = fakeClient(t, http.StatusOK, `{"hits":`)
+	if _, err := SearchWith[user](context.Background(), c, "", nil); err == nil {
+		t.Fatal("truncated response decoded without error")
+	}
+}
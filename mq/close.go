@@ -0,0 +1,174 @@
+package mq
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrClosed = errors.New("mq: closed")
+
+func (client *MQCLIENT) isClosed() bool {
+	client.Lock.Lock()
+	defer client.Lock.Unlock()
+	return client.closed
+}
+
+// Close 依次关闭所有 Consumer（停止接收并等待处理中的消息）、Producer（等待发送和确认完成）、channel 池和连接
+func (client *MQCLIENT) Close(ctx context.Context) error {
+	client.Lock.Lock()
+	if client.closed {
+		client.Lock.Unlock()
+		return nil
+	}
+	client.closed = true
+	if client.cancel != nil {
+		client.cancel()
+	}
+	producers := append([]*Producer(nil), client.producers...)
+	consumers := append([]*Consumer(nil), client.consumers...)
+	client.Lock.Unlock()
+
+	var first error
+	keep := func(err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	for _, c := range consumers {
+		keep(c.Close(ctx))
+	}
+	for _, p := range producers {
+		keep(p.Close(ctx))
+	}
+	if client.channels != nil {
+		client.channels.close()
+	}
+	keep(client.conn().Close())
+	return first
+}
+
+func (client *MQCLIENT) removeProducer(p *Producer) {
+	client.Lock.Lock()
+	defer client.Lock.Unlock()
+	for i, v := range client.producers {
+		if v == p {
+			client.producers = append(client.producers[:i], client.producers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (client *MQCLIENT) removeConsumer(c *Consumer) {
+	client.Lock.Lock()
+	defer client.Lock.Unlock()
+	for i, v := range client.consumers {
+		if v == c {
+			client.consumers = append(client.consumers[:i], client.consumers[i+1:]...)
+			return
+		}
+	}
+}
+
+// wait 等待 inflight 归零，ctx 先结束时返回 ctx.Err()
+func wait(ctx context.Context, inflight interface{ Wait() }) error {
+	idle := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Producer) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// begin 登记一次发送，Close 之后返回 false
+func (p *Producer) begin() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.inflight.Add(1)
+	return true
+}
+
+// Close 拒绝新的发送，等待进行中的发送及其确认完成后关闭 channel 和 outbox
+func (p *Producer) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	p.mu.Unlock()
+
+	err := wait(ctx, &p.inflight)
+	p.mu.Lock()
+	ch := p.Channel
+	p.mu.Unlock()
+	if ch != nil {
+		ch.Close()
+	}
+	if p.outbox != nil {
+		p.outbox.close()
+	}
+	p.Client.removeProducer(p)
+	return err
+}
+
+func (c *Consumer) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// begin 登记一条处理中的消息，Close 之后返回 false，未处理的消息在 channel 关闭后由 broker 重新投递
+func (c *Consumer) begin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.inflight.Add(1)
+	return true
+}
+
+// Close 取消订阅，等待 Serve 中处理中的消息完成后关闭 channel 和 RdData，for range RdData 的循环随之结束；
+// auto ack 模式下已投递未读取的消息会丢失
+func (c *Consumer) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	ch, tag := c.Channel, c.tag
+	c.mu.Unlock()
+
+	if err := ch.Cancel(tag, false); err != nil {
+		c.Logger.Printf("Cancel consumer %s: %s", tag, err.Error())
+	}
+	err := wait(ctx, &c.inflight)
+	ch.Close()
+	c.forwarders.Wait()
+	close(c.deliveries)
+	c.retryMu.Lock()
+	if c.retryPub != nil {
+		c.retryPub.Close()
+		c.retryPub = nil
+	}
+	c.retryMu.Unlock()
+	c.Client.removeConsumer(c)
+	return err
+}
@@ -0,0 +1,79 @@
+package mq
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec 负责消息体的编解码，ContentType 会写入 amqp.Publishing.ContentType
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return "application/json" }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) ContentType() string { return "application/x-msgpack" }
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) { return msgpack.Marshal(v) }
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// ProtoCodec 只能编解码 proto.Message
+type ProtoCodec struct{}
+
+func (ProtoCodec) ContentType() string { return "application/x-protobuf" }
+
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+var (
+	codecLock sync.RWMutex
+	codecs    = map[string]Codec{
+		"":                       JSONCodec{},
+		"text/plain":             JSONCodec{}, // 旧版 Producer 以 text/plain 发送 JSON
+		"application/json":       JSONCodec{},
+		"application/x-msgpack":  MsgpackCodec{},
+		"application/x-protobuf": ProtoCodec{},
+	}
+)
+
+// RegisterCodec 注册自定义 Codec，Consumer 根据消息的 ContentType 选择解码方式
+func RegisterCodec(c Codec) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	codecs[c.ContentType()] = c
+}
+
+func CodecFor(contentType string) (Codec, bool) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	c, ok := codecs[contentType]
+	return c, ok
+}
@@ -0,0 +1,78 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	defaultConfirmTimeout = 10 * time.Second
+	// confirmBuffer 超时后迟到的确认会暂存在缓冲中，避免阻塞 amqp 的分发协程
+	confirmBuffer = 128
+)
+
+var (
+	ErrNacked         = errors.New("message nacked by broker")
+	ErrConfirmTimeout = errors.New("wait for confirm timeout")
+)
+
+// ConfirmError 开启 Confirm 后发送失败时返回，Err 为 ErrNacked、ErrConfirmTimeout 或 channel 关闭的错误
+type ConfirmError struct {
+	Exchange    string
+	Key         string
+	DeliveryTag uint64
+	Err         error
+}
+
+func (e *ConfirmError) Error() string {
+	return fmt.Sprintf("mq confirm exchange:%s, key:%s, tag:%d: %s", e.Exchange, e.Key, e.DeliveryTag, e.Err.Error())
+}
+
+func (e *ConfirmError) Unwrap() error {
+	return e.Err
+}
+
+func (p *Producer) confirmTimeout() time.Duration {
+	if p.Config.ConfirmTimeout > 0 {
+		return time.Duration(p.Config.ConfirmTimeout) * time.Second
+	}
+	return defaultConfirmTimeout
+}
+
+// waitConfirm 等待 tag 对应的确认，之前超时未等到的确认会被跳过，调用方需独占 pc
+func (p *Producer) waitConfirm(ctx context.Context, pc *pubChannel, key string, tag uint64) error {
+	if err := confirmed(ctx, pc, tag, p.confirmTimeout()); err != nil {
+		return &ConfirmError{Exchange: p.Config.Exchange, Key: key, DeliveryTag: tag, Err: err}
+	}
+	return nil
+}
+
+// confirmed ctx 没有期限时最多等待 timeout
+func confirmed(ctx context.Context, pc *pubChannel, tag uint64, timeout time.Duration) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for {
+		select {
+		case c, ok := <-pc.confirms:
+			if !ok {
+				return amqp.ErrClosed
+			}
+			if c.DeliveryTag < tag {
+				continue
+			}
+			if !c.Ack {
+				return ErrNacked
+			}
+			return nil
+		case <-ctx.Done():
+			return ErrConfirmTimeout
+		}
+	}
+}
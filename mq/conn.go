@@ -0,0 +1,109 @@
+package mq
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// ConnConfig 连接配置，URLs 支持 amqp:// 和 amqps://，多个节点在连接失败时轮流尝试
+type ConnConfig struct {
+	URLs []string   `json:"urls"`
+	TLS  *TLSConfig `json:"tls"`
+	// External 使用 SASL EXTERNAL，以客户端证书认证，需配合 TLS.CertFile/KeyFile
+	External bool `json:"external"`
+	// Heartbeat 心跳间隔（秒），0 时为 10 秒
+	Heartbeat int `json:"heartbeat"`
+	// ConnectionName 在管理界面中显示的连接名
+	ConnectionName string `json:"connection_name"`
+}
+
+type TLSConfig struct {
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+func (t *TLSConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: t.ServerName, InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("mq: no certificate in " + t.CAFile)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// externalAuth SASL EXTERNAL，身份由 TLS 客户端证书确定
+type externalAuth struct{}
+
+func (externalAuth) Mechanism() string { return "EXTERNAL" }
+
+func (externalAuth) Response() string { return "" }
+
+func (c *ConnConfig) amqpConfig() (amqp.Config, error) {
+	cfg := amqp.Config{Heartbeat: 10 * time.Second, Locale: "en_US"}
+	if c.Heartbeat > 0 {
+		cfg.Heartbeat = time.Duration(c.Heartbeat) * time.Second
+	}
+	if c.ConnectionName != "" {
+		cfg.Properties = amqp.Table{
+			"product":         "github.com/zhaihao-zhugh/tools/mq",
+			"connection_name": c.ConnectionName,
+		}
+	}
+	if c.TLS != nil {
+		tlsConfig, err := c.TLS.tlsConfig()
+		if err != nil {
+			return cfg, err
+		}
+		cfg.TLSClientConfig = tlsConfig
+	}
+	if c.External {
+		cfg.SASL = []amqp.Authentication{externalAuth{}}
+	}
+	return cfg, nil
+}
+
+// dial 从 urls[start] 开始，每次尝试使用下一个节点，返回连接成功的节点下标
+func dial(ctx context.Context, urls []string, start int, cfg amqp.Config, policy RetryPolicy, logger Logger) (*amqp.Connection, int, error) {
+	var conn *amqp.Connection
+	node := start - 1
+	err := policy.Do(ctx, logger, "MQ Client connect", func() (err error) {
+		node = (node + 1) % len(urls)
+		if cfg.Heartbeat == 0 {
+			conn, err = amqp.Dial(urls[node])
+			return
+		}
+		c := cfg
+		if cfg.TLSClientConfig != nil {
+			c.TLSClientConfig = cfg.TLSClientConfig.Clone()
+		}
+		conn, err = amqp.DialConfig(urls[node], c)
+		return
+	})
+	if err != nil {
+		return nil, node, err
+	}
+	logger.Printf("MQ Client seccess")
+	return conn, node, nil
+}
@@ -0,0 +1,134 @@
+package mq
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	defaultDedupTTL      = 24 * time.Hour
+	defaultDedupCapacity = 100000
+)
+
+// DedupConfig 配置后 Consumer.Serve 跳过已处理过的消息（直接 Ack），用于去掉重连后 broker 重投的消息
+type DedupConfig struct {
+	// Header 去重 key 取自该消息头，为空时使用 MessageId；取不到 key 的消息不去重
+	Header string `json:"header"`
+	// TTL 已处理记录的保留时间（秒），默认 24 小时
+	TTL int `json:"ttl"`
+}
+
+func (cfg *DedupConfig) ttl() time.Duration {
+	if cfg.TTL <= 0 {
+		return defaultDedupTTL
+	}
+	return time.Duration(cfg.TTL) * time.Second
+}
+
+func (cfg *DedupConfig) key(d amqp.Delivery) string {
+	if cfg.Header == "" {
+		return d.MessageId
+	}
+	if v, ok := d.Headers[cfg.Header]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// DedupStore 记录已处理的消息 key。handler 成功后才调用 Mark，处理中断的消息重投后仍会被处理
+type DedupStore interface {
+	Seen(ctx context.Context, key string) (bool, error)
+	Mark(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// duplicate 消息已处理过时返回 true；store 出错时按未处理返回，宁可重复也不丢消息
+func (c *Consumer) duplicate(ctx context.Context, d amqp.Delivery) (key string, dup bool) {
+	if c.Config.Dedup == nil || c.DedupStore == nil {
+		return "", false
+	}
+	if key = c.Config.Dedup.key(d); key == "" {
+		return "", false
+	}
+	seen, err := c.DedupStore.Seen(ctx, key)
+	if err != nil {
+		c.Logger.Printf("Dedup check %s: %s", key, err.Error())
+		return key, false
+	}
+	return key, seen
+}
+
+func (c *Consumer) markDone(ctx context.Context, key string) {
+	if err := c.DedupStore.Mark(ctx, key, c.Config.Dedup.ttl()); err != nil {
+		c.Logger.Printf("Dedup mark %s: %s", key, err.Error())
+	}
+}
+
+// MemoryDedupStore 进程内 LRU + TTL 去重，超过容量时淘汰最久未使用的记录
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryDedupStore capacity 小于等于 0 时使用 defaultDedupCapacity
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = defaultDedupCapacity
+	}
+	return &MemoryDedupStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryDedupStore) Seen(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(e.Value.(*dedupEntry).expires) {
+		s.ll.Remove(e)
+		delete(s.items, key)
+		return false, nil
+	}
+	s.ll.MoveToFront(e)
+	return true, nil
+}
+
+func (s *MemoryDedupStore) Mark(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires := time.Now().Add(ttl)
+	if e, ok := s.items[key]; ok {
+		e.Value.(*dedupEntry).expires = expires
+		s.ll.MoveToFront(e)
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(&dedupEntry{key, expires})
+	for s.ll.Len() > s.capacity {
+		e := s.ll.Back()
+		s.ll.Remove(e)
+		delete(s.items, e.Value.(*dedupEntry).key)
+	}
+	return nil
+}
+
+func (s *MemoryDedupStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
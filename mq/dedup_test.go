@@ -0,0 +1,116 @@
+package mq
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestMemoryDedupStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryDedupStore(0)
+	s.Mark(ctx, "short", time.Millisecond)
+	s.Mark(ctx, "long", time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	if seen, _ := s.Seen(ctx, "short"); seen {
+		t.Error("expired key reported as seen")
+	}
+	if seen, _ := s.Seen(ctx, "long"); !seen {
+		t.Error("live key not seen")
+	}
+	if n := s.Len(); n != 1 {
+		t.Errorf("Len = %d, want 1 after expired key removed", n)
+	}
+
+	// 再次 Mark 延长有效期
+	s.Mark(ctx, "short", time.Millisecond)
+	s.Mark(ctx, "short", time.Hour)
+	time.Sleep(5 * time.Millisecond)
+	if seen, _ := s.Seen(ctx, "short"); !seen {
+		t.Error("re-marked key expired")
+	}
+}
+
+func TestMemoryDedupStoreLRU(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryDedupStore(2)
+	s.Mark(ctx, "a", time.Hour)
+	s.Mark(ctx, "b", time.Hour)
+	s.Seen(ctx, "a") // a 变为最近使用
+	s.Mark(ctx, "c", time.Hour)
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if seen, _ := s.Seen(ctx, key); seen != want {
+			t.Errorf("Seen(%s) = %v, want %v", key, seen, want)
+		}
+	}
+	if n := s.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+}
+
+type ackRecorder struct {
+	acks chan string
+}
+
+func (r *ackRecorder) Ack(tag uint64, multiple bool) error {
+	r.acks <- "ack"
+	return nil
+}
+
+func (r *ackRecorder) Nack(tag uint64, multiple, requeue bool) error {
+	r.acks <- "nack"
+	return nil
+}
+
+func (r *ackRecorder) Reject(tag uint64, requeue bool) error {
+	r.acks <- "reject"
+	return nil
+}
+
+func TestServeDedup(t *testing.T) {
+	deliveries := make(chan amqp.Delivery)
+	c := &Consumer{
+		Client: &MQCLIENT{},
+		Config: &ChannelConfig{ManualAck: true, Dedup: &DedupConfig{}},
+		Logger: log.New(io.Discard, "", 0),
+		RdData: deliveries,
+		done:   make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var handled []string
+	go c.Serve(ctx, func(ctx context.Context, d amqp.Delivery) error {
+		handled = append(handled, d.MessageId)
+		return nil
+	})
+
+	rec := &ackRecorder{acks: make(chan string, 1)}
+	for _, id := range []string{"m1", "m1", "m2", ""} {
+		deliveries <- amqp.Delivery{Acknowledger: rec, MessageId: id}
+		select {
+		case outcome := <-rec.acks:
+			if outcome != "ack" {
+				t.Fatalf("%s: %s, want ack", id, outcome)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s not settled", id)
+		}
+	}
+	cancel()
+
+	want := []string{"m1", "m2", ""}
+	if len(handled) != len(want) {
+		t.Fatalf("handled %q, want %q", handled, want)
+	}
+	for i := range want {
+		if handled[i] != want[i] {
+			t.Fatalf("handled %q, want %q", handled, want)
+		}
+	}
+}
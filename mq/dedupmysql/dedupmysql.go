@@ -0,0 +1,52 @@
+// Package dedupmysql 以 MySQL 表实现 mq.DedupStore，供多个消费者实例共享去重记录
+package dedupmysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/zhaihao-zhugh/tools/db/mysql"
+	"github.com/zhaihao-zhugh/tools/mq"
+	"gorm.io/gorm/clause"
+)
+
+// MqDedup Store 的表结构
+type MqDedup struct {
+	MessageKey string    `gorm:"primaryKey;size:191"`
+	ExpiresAt  time.Time `gorm:"index"`
+}
+
+// Store 过期记录由 Purge 清理
+type Store struct {
+	DB *mysql.DB
+}
+
+var _ mq.DedupStore = (*Store)(nil)
+
+// New 自动建表 mq_dedup
+func New(db *mysql.DB) (*Store, error) {
+	if err := db.AutoMigrate(&MqDedup{}); err != nil {
+		return nil, err
+	}
+	return &Store{DB: db}, nil
+}
+
+func (s *Store) Seen(ctx context.Context, key string) (bool, error) {
+	var count int64
+	err := s.DB.WithContext(ctx).Model(&MqDedup{}).
+		Where("message_key = ? AND expires_at > ?", key, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *Store) Mark(ctx context.Context, key string, ttl time.Duration) error {
+	return s.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).Create(&MqDedup{MessageKey: key, ExpiresAt: time.Now().Add(ttl)}).Error
+}
+
+// Purge 删除已过期的记录，返回删除的行数
+func (s *Store) Purge(ctx context.Context) (int64, error) {
+	res := s.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&MqDedup{})
+	return res.RowsAffected, res.Error
+}
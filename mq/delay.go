@@ -0,0 +1,193 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	DelayPlugin = "plugin"
+	DelayTTL    = "ttl"
+)
+
+// delayState 已声明的延迟拓扑，重连后重新声明
+type delayState struct {
+	mu       sync.Mutex
+	declared map[int64]time.Time
+}
+
+// PublishAfter 消息在 delay 之后才投递到 Config.Exchange，delay 小于等于 0 时立即发送。
+// 延迟消息不经过 outbox；ttl 方式的延迟时间按 DelayPrecision 向上取整。
+func (p *Producer) PublishAfter(ctx context.Context, delay time.Duration, key string, action string, data interface{}, opts ...PublishOption) error {
+	msg, err := newPublishing(ctx, p.codec(), action, data, opts)
+	if err != nil {
+		return err
+	}
+	if !p.begin() {
+		return ErrClosed
+	}
+	defer p.inflight.Done()
+	if delay <= 0 {
+		return p.publish(ctx, p.Config.Exchange, key, msg)
+	}
+	exchange, err := p.delayExchange(delay, &msg)
+	if err != nil {
+		return err
+	}
+	return p.publish(ctx, exchange, key, msg)
+}
+
+// PublishAt 消息在 at 时刻投递，at 已过去时立即发送
+func (p *Producer) PublishAt(ctx context.Context, at time.Time, key string, action string, data interface{}, opts ...PublishOption) error {
+	return p.PublishAfter(ctx, time.Until(at), key, action, data, opts...)
+}
+
+func (p *Producer) resetDelays() {
+	p.delay.mu.Lock()
+	p.delay.declared = nil
+	p.delay.mu.Unlock()
+}
+
+// delayExchange 返回延迟消息应发往的 exchange，必要时声明延迟拓扑
+func (p *Producer) delayExchange(delay time.Duration, msg *amqp.Publishing) (string, error) {
+	d := &p.delay
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.declared == nil {
+		d.declared = make(map[int64]time.Time)
+	}
+	mode := p.Config.Delay
+	if mode == "" {
+		mode = DelayTTL
+	}
+
+	switch mode {
+	case DelayPlugin:
+		if _, ok := d.declared[0]; !ok {
+			if err := p.declareDelayPlugin(); err != nil {
+				return "", err
+			}
+			d.declared[0] = time.Now()
+		}
+		headers := amqp.Table{}
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		headers["x-delay"] = delay.Milliseconds()
+		msg.Headers = headers
+		return p.delayedExchangeName(), nil
+	case DelayTTL:
+		precision := p.delayPrecision(delay)
+		ttl := (delay + precision - 1) / precision * precision
+		ms := ttl.Milliseconds()
+		// 队列带 x-expires，发送消息不算使用，超过一个延迟周期未声明时重新声明以保证队列在消息过期前不被删除
+		if last, ok := d.declared[ms]; !ok || time.Since(last) > ttl {
+			if err := p.declareDelayQueue(ms); err != nil {
+				return "", err
+			}
+			d.declared[ms] = time.Now()
+		}
+		return p.delayQueueName(ms), nil
+	}
+	return "", errors.New("mq: unknown delay mode " + mode)
+}
+
+// delayPrecision 未配置 DelayPrecision 时按延迟长短取整：1 分钟内 1 秒，1 小时内 10 秒，更长 1 分钟，限制 TTL 队列的数量
+func (p *Producer) delayPrecision(delay time.Duration) time.Duration {
+	if p.Config.DelayPrecision > 0 {
+		return time.Duration(p.Config.DelayPrecision) * time.Second
+	}
+	switch {
+	case delay <= time.Minute:
+		return time.Second
+	case delay <= time.Hour:
+		return 10 * time.Second
+	}
+	return time.Minute
+}
+
+func (p *Producer) delayedExchangeName() string {
+	return p.Config.Exchange + ".delayed"
+}
+
+// delayQueueName ttl 方式下 exchange 与队列同名
+func (p *Producer) delayQueueName(ms int64) string {
+	base := p.Config.Exchange
+	if base == "" {
+		base = "default"
+	}
+	if ms%1000 == 0 {
+		return fmt.Sprintf("%s.delay.%ds", base, ms/1000)
+	}
+	return fmt.Sprintf("%s.delay.%dms", base, ms)
+}
+
+// declareDelayPlugin 声明 fanout 类型的 x-delayed-message exchange 并绑定到 Config.Exchange，消息到期后保留原 routing key 转发
+func (p *Producer) declareDelayPlugin() error {
+	if p.Config.Exchange == "" {
+		return errors.New("mq: delayed message exchange can not bind to default exchange")
+	}
+	ch, err := p.Client.conn().Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	name := p.delayedExchangeName()
+	err = ch.ExchangeDeclare(
+		name,                // name
+		"x-delayed-message", // type
+		p.Config.Durable,    // durable
+		false,               // auto-deleted
+		false,               // internal
+		false,               // no-wait
+		amqp.Table{"x-delayed-type": "fanout"},
+	)
+	if err != nil {
+		return err
+	}
+	return ch.ExchangeBind(p.Config.Exchange, "", name, false, nil)
+}
+
+// declareDelayQueue 声明 fanout exchange 和带 x-message-ttl 的同名队列，消息过期后以原 routing key 死信到 Config.Exchange。
+// 队列长时间不用时按 x-expires 删除，exchange 为 auto-delete，随队列的 binding 一起删除。
+func (p *Producer) declareDelayQueue(ms int64) error {
+	ch, err := p.Client.conn().Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	name := p.delayQueueName(ms)
+	err = ch.ExchangeDeclare(
+		name,             // name
+		"fanout",         // type
+		p.Config.Durable, // durable
+		true,             // auto-deleted
+		false,            // internal
+		false,            // no-wait
+		nil,              // arguments
+	)
+	if err != nil {
+		return err
+	}
+	_, err = ch.QueueDeclare(
+		name,             // name
+		p.Config.Durable, // durable
+		false,            // delete when unused
+		false,            // exclusive
+		false,            // no-wait
+		amqp.Table{
+			"x-message-ttl":          ms,
+			"x-dead-letter-exchange": p.Config.Exchange,
+			"x-expires":              2*ms + int64(time.Minute/time.Millisecond),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return ch.QueueBind(name, "", name, false, nil)
+}
@@ -0,0 +1,38 @@
+package mq
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+)
+
+// Publisher Producer 的发送接口，测试中可以用 MemBroker.NewProducer 替代
+type Publisher interface {
+	PublishMsg(data interface{}) error
+	PublishMsgContext(ctx context.Context, data interface{}, opts ...PublishOption) error
+	PublishMsgWithKey(key string, data interface{}) error
+	PublishMsgWithKeyContext(ctx context.Context, key string, data interface{}, opts ...PublishOption) error
+	PublishAction(ctx context.Context, key string, action string, data interface{}, opts ...PublishOption) error
+	Close(ctx context.Context) error
+}
+
+// Subscriber Consumer 的消费接口，测试中可以用 MemBroker.NewConsumer 替代
+type Subscriber interface {
+	Routable
+	Deliveries() <-chan amqp.Delivery
+	Serve(ctx context.Context, handler Handler) error
+	Dispatch(ctx context.Context, d amqp.Delivery) error
+	Close(ctx context.Context) error
+}
+
+var (
+	_ Publisher  = (*Producer)(nil)
+	_ Publisher  = (*MemProducer)(nil)
+	_ Subscriber = (*Consumer)(nil)
+	_ Subscriber = (*MemConsumer)(nil)
+)
+
+// Deliveries 返回 RdData
+func (c *Consumer) Deliveries() <-chan amqp.Delivery {
+	return c.RdData
+}
@@ -0,0 +1,259 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Management RabbitMQ 管理 API（rabbitmq_management 插件），用于设置 policy 和对比 Topology 与 broker 的差异
+type Management struct {
+	// URL 如 http://127.0.0.1:15672
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Vhost 默认 /
+	Vhost string `json:"vhost"`
+	// Client 为空时使用 http.DefaultClient
+	Client *http.Client `json:"-"`
+}
+
+// Change Diff 的一项差异，Action 为 create、update 或 conflict；conflict 表示属性不一致，需要删除后重建
+type Change struct {
+	Action string
+	Kind   string
+	Name   string
+	Detail string
+}
+
+func (c Change) String() string {
+	if c.Detail == "" {
+		return c.Action + " " + c.Kind + " " + c.Name
+	}
+	return c.Action + " " + c.Kind + " " + c.Name + ": " + c.Detail
+}
+
+type mgmtExchange struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Internal   bool                   `json:"internal"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+type mgmtQueue struct {
+	Name       string                 `json:"name"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Exclusive  bool                   `json:"exclusive"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+type mgmtBinding struct {
+	Source          string                 `json:"source"`
+	Destination     string                 `json:"destination"`
+	DestinationType string                 `json:"destination_type"`
+	RoutingKey      string                 `json:"routing_key"`
+	Arguments       map[string]interface{} `json:"arguments"`
+}
+
+type mgmtPolicy struct {
+	Name       string                 `json:"name"`
+	Pattern    string                 `json:"pattern"`
+	ApplyTo    string                 `json:"apply-to"`
+	Priority   int                    `json:"priority"`
+	Definition map[string]interface{} `json:"definition"`
+}
+
+func (m *Management) vhost() string {
+	if m.Vhost == "" {
+		return url.PathEscape("/")
+	}
+	return url.PathEscape(m.Vhost)
+}
+
+func (m *Management) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(m.URL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.Username, m.Password)
+	req.Header.Set("Content-Type", "application/json")
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("mq management %s %s: %s %s", method, path, res.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (m *Management) PutPolicy(ctx context.Context, p PolicySpec) error {
+	return m.do(ctx, http.MethodPut, "/api/policies/"+m.vhost()+"/"+url.PathEscape(p.Name), mgmtPolicy{
+		Pattern:    p.Pattern,
+		ApplyTo:    p.applyTo(),
+		Priority:   p.Priority,
+		Definition: p.Definition,
+	}, nil)
+}
+
+// Diff 对比 Topology 与 broker 的当前状态，返回 DeclareTopology 将要做的改动，不修改 broker；
+// 只检查 Topology 中描述的对象，broker 上多出的对象不会报告
+func (m *Management) Diff(ctx context.Context, t *Topology) ([]Change, error) {
+	var (
+		exchanges []mgmtExchange
+		queues    []mgmtQueue
+		bindings  []mgmtBinding
+		policies  []mgmtPolicy
+		changes   []Change
+	)
+	vhost := m.vhost()
+	if err := m.do(ctx, http.MethodGet, "/api/exchanges/"+vhost, nil, &exchanges); err != nil {
+		return nil, err
+	}
+	if err := m.do(ctx, http.MethodGet, "/api/queues/"+vhost, nil, &queues); err != nil {
+		return nil, err
+	}
+	if err := m.do(ctx, http.MethodGet, "/api/bindings/"+vhost, nil, &bindings); err != nil {
+		return nil, err
+	}
+	if len(t.Policies) > 0 {
+		if err := m.do(ctx, http.MethodGet, "/api/policies/"+vhost, nil, &policies); err != nil {
+			return nil, err
+		}
+	}
+
+	liveExchanges := make(map[string]mgmtExchange, len(exchanges))
+	for _, e := range exchanges {
+		liveExchanges[e.Name] = e
+	}
+	for _, e := range t.Exchanges {
+		live, ok := liveExchanges[e.Name]
+		if !ok {
+			changes = append(changes, Change{Action: "create", Kind: "exchange", Name: e.Name})
+			continue
+		}
+		var diff []string
+		diff = diffField(diff, "type", live.Type, e.Type)
+		diff = diffField(diff, "durable", live.Durable, e.Durable)
+		diff = diffField(diff, "auto_delete", live.AutoDelete, e.AutoDelete)
+		diff = diffField(diff, "internal", live.Internal, e.Internal)
+		diff = diffArgs(diff, live.Arguments, e.Arguments)
+		if len(diff) > 0 {
+			changes = append(changes, Change{Action: "conflict", Kind: "exchange", Name: e.Name, Detail: strings.Join(diff, ", ")})
+		}
+	}
+
+	liveQueues := make(map[string]mgmtQueue, len(queues))
+	for _, q := range queues {
+		liveQueues[q.Name] = q
+	}
+	for _, q := range t.Queues {
+		live, ok := liveQueues[q.Name]
+		if !ok {
+			changes = append(changes, Change{Action: "create", Kind: "queue", Name: q.Name})
+			continue
+		}
+		var diff []string
+		diff = diffField(diff, "durable", live.Durable, q.durable())
+		diff = diffField(diff, "auto_delete", live.AutoDelete, q.AutoDelete)
+		diff = diffField(diff, "exclusive", live.Exclusive, q.Exclusive)
+		diff = diffArgs(diff, live.Arguments, q.args())
+		if len(diff) > 0 {
+			changes = append(changes, Change{Action: "conflict", Kind: "queue", Name: q.Name, Detail: strings.Join(diff, ", ")})
+		}
+	}
+
+	for _, b := range t.Bindings {
+		found := false
+		for _, live := range bindings {
+			if live.Source == b.Source && live.Destination == b.Destination && live.DestinationType == b.destinationType() &&
+				live.RoutingKey == b.Key && argsEqual(live.Arguments, b.Arguments) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			changes = append(changes, Change{Action: "create", Kind: "binding", Name: b.Source + " -> " + b.destinationType() + " " + b.Destination, Detail: "key " + b.Key})
+		}
+	}
+
+	livePolicies := make(map[string]mgmtPolicy, len(policies))
+	for _, p := range policies {
+		livePolicies[p.Name] = p
+	}
+	for _, p := range t.Policies {
+		live, ok := livePolicies[p.Name]
+		if !ok {
+			changes = append(changes, Change{Action: "create", Kind: "policy", Name: p.Name})
+			continue
+		}
+		var diff []string
+		diff = diffField(diff, "pattern", live.Pattern, p.Pattern)
+		diff = diffField(diff, "apply_to", live.ApplyTo, p.applyTo())
+		diff = diffField(diff, "priority", live.Priority, p.Priority)
+		if !argsEqual(live.Definition, p.Definition) {
+			diff = append(diff, "definition")
+		}
+		if len(diff) > 0 {
+			changes = append(changes, Change{Action: "update", Kind: "policy", Name: p.Name, Detail: strings.Join(diff, ", ")})
+		}
+	}
+	return changes, nil
+}
+
+func diffField(diff []string, name string, live, want interface{}) []string {
+	if live != want {
+		diff = append(diff, fmt.Sprintf("%s %v -> %v", name, live, want))
+	}
+	return diff
+}
+
+func diffArgs(diff []string, live, want map[string]interface{}) []string {
+	if !argsEqual(live, want) {
+		l, _ := json.Marshal(live)
+		w, _ := json.Marshal(want)
+		diff = append(diff, fmt.Sprintf("arguments %s -> %s", l, w))
+	}
+	return diff
+}
+
+// argsEqual 按 JSON 编码比较，管理 API 返回的数字都是 float64
+func argsEqual(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
@@ -0,0 +1,119 @@
+package mq
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const (
+	mgmtExchanges = `[
+		{"name": "orders", "type": "topic", "durable": true, "arguments": {}},
+		{"name": "events", "type": "fanout", "durable": true, "arguments": {}}
+	]`
+	mgmtQueues = `[
+		{"name": "jobs", "durable": true, "arguments": {"x-max-length": 1000, "x-queue-type": "quorum"}},
+		{"name": "tmp", "durable": false, "auto_delete": true, "arguments": {}}
+	]`
+	mgmtBindings = `[
+		{"source": "orders", "destination": "jobs", "destination_type": "queue", "routing_key": "order.*", "arguments": {}}
+	]`
+	mgmtPolicies = `[
+		{"name": "ttl", "pattern": "^jobs$", "apply-to": "queues", "priority": 0, "definition": {"message-ttl": 60000}},
+		{"name": "same", "pattern": ".*", "apply-to": "all", "priority": 1, "definition": {"max-length": 10}}
+	]`
+)
+
+func TestManagementDiff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "guest" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/exchanges/%2F":
+			w.Write([]byte(mgmtExchanges))
+		case "/api/queues/%2F":
+			w.Write([]byte(mgmtQueues))
+		case "/api/bindings/%2F":
+			w.Write([]byte(mgmtBindings))
+		case "/api/policies/%2F":
+			w.Write([]byte(mgmtPolicies))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	topology := &Topology{
+		Exchanges: []ExchangeSpec{
+			{Name: "orders", Type: "topic", Durable: true},
+			{Name: "events", Type: "topic", Durable: true},
+			{Name: "audit", Type: "fanout", Durable: true},
+		},
+		Queues: []QueueSpec{
+			// 配置中的整数与管理 API 返回的 float64 相等
+			{Name: "jobs", Type: QueueQuorum, Arguments: map[string]interface{}{"x-max-length": 1000}},
+			{Name: "tmp", Durable: true},
+			{Name: "new"},
+		},
+		Bindings: []BindingSpec{
+			{Source: "orders", Destination: "jobs", Key: "order.*"},
+			{Source: "orders", Destination: "jobs", Key: "order.paid"},
+		},
+		Policies: []PolicySpec{
+			{Name: "ttl", Pattern: "^jobs$", ApplyTo: "queues", Definition: map[string]interface{}{"message-ttl": 30000}},
+			{Name: "same", Pattern: ".*", Priority: 1, Definition: map[string]interface{}{"max-length": 10}},
+			{Name: "ha", Pattern: ".*"},
+		},
+	}
+	m := &Management{URL: srv.URL, Username: "guest", Password: "secret"}
+	changes, err := m.Diff(context.Background(), topology)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"conflict exchange events: type fanout -> topic",
+		"create exchange audit",
+		"conflict queue tmp: durable false -> true, auto_delete true -> false",
+		"create queue new",
+		"create binding orders -> queue jobs: key order.paid",
+		"update policy ttl: definition",
+		"create policy ha",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff =\n%q\nwant\n%q", got, want)
+	}
+
+	m.Password = "wrong"
+	if _, err := m.Diff(context.Background(), topology); err == nil {
+		t.Fatal("Diff with bad credentials succeeded")
+	}
+}
+
+func TestArgsEqual(t *testing.T) {
+	tests := []struct {
+		a, b map[string]interface{}
+		want bool
+	}{
+		{nil, map[string]interface{}{}, true},
+		{map[string]interface{}{"x-max-length": float64(1000)}, map[string]interface{}{"x-max-length": 1000}, true},
+		{map[string]interface{}{"x-max-length": float64(1000)}, map[string]interface{}{"x-max-length": int64(1000)}, true},
+		{map[string]interface{}{"x-max-length": float64(1000)}, map[string]interface{}{"x-max-length": 100}, false},
+		{map[string]interface{}{"ratio": 0.5}, map[string]interface{}{"ratio": 0.5}, true},
+		{map[string]interface{}{"x-queue-type": "quorum"}, map[string]interface{}{"x-queue-type": "classic"}, false},
+		{map[string]interface{}{"a": 1}, nil, false},
+		{map[string]interface{}{"nested": map[string]interface{}{"n": float64(1)}}, map[string]interface{}{"nested": map[string]interface{}{"n": 1}}, true},
+	}
+	for _, tt := range tests {
+		if got := argsEqual(tt.a, tt.b); got != tt.want {
+			t.Errorf("argsEqual(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
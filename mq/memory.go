@@ -0,0 +1,498 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// MemBroker 内存中的 broker，按 ChannelConfig 声明 exchange/queue/binding，
+// 支持 direct、fanout、topic（* 匹配一个单词，# 匹配零或多个单词）以及默认 exchange，用于不依赖 RabbitMQ 的单元测试。
+// 不模拟 Retry 的延迟队列，可重试的错误会立即重新入队。
+type MemBroker struct {
+	mu        sync.Mutex
+	exchanges map[string]string
+	bindings  map[string][]memBinding
+	queues    map[string]*memQueue
+	tag       uint64
+	seq       int
+	logger    Logger
+}
+
+type memBinding struct {
+	queue string
+	key   string
+}
+
+// NewMemBroker opts 中只有 WithLogger 生效
+func NewMemBroker(opts ...ClientOption) *MemBroker {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &MemBroker{
+		exchanges: make(map[string]string),
+		bindings:  make(map[string][]memBinding),
+		queues:    make(map[string]*memQueue),
+		logger:    o.logger,
+	}
+}
+
+func (b *MemBroker) declareExchange(cfg *ChannelConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.exchanges[cfg.Exchange]; !ok {
+		b.exchanges[cfg.Exchange] = cfg.Type
+	}
+}
+
+func (b *MemBroker) declareQueue(name string) *memQueue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if name == "" {
+		b.seq++
+		name = fmt.Sprintf("amq.gen-%d", b.seq)
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memQueue{name: name, broker: b, wait: make(chan struct{}), unacked: make(map[uint64]memUnacked)}
+		b.queues[name] = q
+	}
+	return q
+}
+
+func (b *MemBroker) bind(exchange, queue, key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, v := range b.bindings[exchange] {
+		if v.queue == queue && v.key == key {
+			return
+		}
+	}
+	b.bindings[exchange] = append(b.bindings[exchange], memBinding{queue: queue, key: key})
+}
+
+// Publish 将消息按 exchange 类型路由到已绑定的队列
+func (b *MemBroker) Publish(exchange, key string, msg amqp.Publishing) error {
+	b.mu.Lock()
+	var targets []*memQueue
+	if exchange == "" {
+		if q, ok := b.queues[key]; ok {
+			targets = append(targets, q)
+		}
+	} else {
+		kind, ok := b.exchanges[exchange]
+		if !ok {
+			b.mu.Unlock()
+			return fmt.Errorf("exchange %s not found", exchange)
+		}
+		seen := make(map[string]bool)
+		for _, v := range b.bindings[exchange] {
+			if seen[v.queue] || !routeMatch(kind, v.key, key) {
+				continue
+			}
+			seen[v.queue] = true
+			targets = append(targets, b.queues[v.queue])
+		}
+	}
+	b.mu.Unlock()
+
+	for _, q := range targets {
+		q.push(amqp.Delivery{
+			Headers:         msg.Headers,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    msg.DeliveryMode,
+			Priority:        msg.Priority,
+			CorrelationId:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			Expiration:      msg.Expiration,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			UserId:          msg.UserId,
+			AppId:           msg.AppId,
+			Exchange:        exchange,
+			RoutingKey:      key,
+			Body:            msg.Body,
+		})
+	}
+	return nil
+}
+
+// QueueLen 返回队列中等待投递的消息数量
+func (b *MemBroker) QueueLen(queue string) int {
+	b.mu.Lock()
+	q, ok := b.queues[queue]
+	b.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.ready)
+}
+
+func (b *MemBroker) nextTag() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tag++
+	return b.tag
+}
+
+func routeMatch(kind, pattern, key string) bool {
+	switch kind {
+	case amqp.ExchangeFanout:
+		return true
+	case amqp.ExchangeTopic:
+		return topicMatch(strings.Split(pattern, "."), strings.Split(key, "."))
+	default:
+		return pattern == key
+	}
+}
+
+func topicMatch(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if topicMatch(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && topicMatch(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && topicMatch(pattern[1:], words[1:])
+	}
+}
+
+type memUnacked struct {
+	d     amqp.Delivery
+	owner *MemConsumer
+}
+
+// memQueue 实现 amqp.Acknowledger
+type memQueue struct {
+	name   string
+	broker *MemBroker
+	// dlExchange/dlKey 对应 x-dead-letter-exchange/x-dead-letter-routing-key，dlKey 为空时沿用原 routing key
+	dlExchange string
+	dlKey      string
+
+	mu      sync.Mutex
+	ready   []amqp.Delivery
+	unacked map[uint64]memUnacked
+	wait    chan struct{}
+}
+
+func (q *memQueue) push(d amqp.Delivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ready = append(q.ready, d)
+	close(q.wait)
+	q.wait = make(chan struct{})
+}
+
+// pop 取出一条消息，队列为空时返回在下一次 push 时关闭的 channel
+func (q *memQueue) pop(owner *MemConsumer) (amqp.Delivery, bool, <-chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.ready) == 0 {
+		return amqp.Delivery{}, false, q.wait
+	}
+	d := q.ready[0]
+	q.ready = q.ready[1:]
+	d.Acknowledger = q
+	d.DeliveryTag = q.broker.nextTag()
+	d.ConsumerTag = owner.tag
+	q.unacked[d.DeliveryTag] = memUnacked{d: d, owner: owner}
+	return d, true, nil
+}
+
+func (q *memQueue) settle(tag uint64, multiple bool) []amqp.Delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var ds []amqp.Delivery
+	for t, v := range q.unacked {
+		if t == tag || (multiple && t < tag && v.owner == q.unacked[tag].owner) {
+			ds = append(ds, v.d)
+		}
+	}
+	for _, d := range ds {
+		delete(q.unacked, d.DeliveryTag)
+	}
+	return ds
+}
+
+func (q *memQueue) requeue(ds []amqp.Delivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, d := range ds {
+		d.Redelivered = true
+		q.ready = append(q.ready, d)
+	}
+	if len(ds) > 0 {
+		close(q.wait)
+		q.wait = make(chan struct{})
+	}
+}
+
+func (q *memQueue) deadLetter(ds []amqp.Delivery) {
+	if q.dlExchange == "" && q.dlKey == "" {
+		return
+	}
+	for _, d := range ds {
+		key := d.RoutingKey
+		if q.dlKey != "" {
+			key = q.dlKey
+		}
+		q.broker.Publish(q.dlExchange, key, amqp.Publishing{
+			Headers:       d.Headers,
+			ContentType:   d.ContentType,
+			DeliveryMode:  d.DeliveryMode,
+			CorrelationId: d.CorrelationId,
+			ReplyTo:       d.ReplyTo,
+			MessageId:     d.MessageId,
+			Timestamp:     d.Timestamp,
+			Type:          d.Type,
+			AppId:         d.AppId,
+			Body:          d.Body,
+		})
+	}
+}
+
+func (q *memQueue) Ack(tag uint64, multiple bool) error {
+	q.settle(tag, multiple)
+	return nil
+}
+
+func (q *memQueue) Nack(tag uint64, multiple bool, requeue bool) error {
+	ds := q.settle(tag, multiple)
+	if requeue {
+		q.requeue(ds)
+	} else {
+		q.deadLetter(ds)
+	}
+	return nil
+}
+
+func (q *memQueue) Reject(tag uint64, requeue bool) error {
+	return q.Nack(tag, false, requeue)
+}
+
+// MemProducer 发送到 MemBroker 的 Publisher
+type MemProducer struct {
+	Config *ChannelConfig
+	Codec  Codec
+
+	broker *MemBroker
+	mu     sync.Mutex
+	closed bool
+}
+
+func (b *MemBroker) NewProducer(cfg *ChannelConfig) *MemProducer {
+	b.declareExchange(cfg)
+	return &MemProducer{Config: cfg, broker: b}
+}
+
+func (p *MemProducer) codec() Codec {
+	if p.Codec == nil {
+		return JSONCodec{}
+	}
+	return p.Codec
+}
+
+func (p *MemProducer) send(ctx context.Context, keys []string, action string, data interface{}, opts []PublishOption) error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	msg, err := newPublishing(ctx, p.codec(), action, data, opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range keys {
+		if err := p.broker.Publish(p.Config.Exchange, v, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *MemProducer) PublishMsg(data interface{}) error {
+	return p.send(context.Background(), p.Config.Key, "", data, nil)
+}
+
+func (p *MemProducer) PublishMsgContext(ctx context.Context, data interface{}, opts ...PublishOption) error {
+	return p.send(ctx, p.Config.Key, "", data, opts)
+}
+
+func (p *MemProducer) PublishMsgWithKey(key string, data interface{}) error {
+	return p.send(context.Background(), []string{key}, "", data, nil)
+}
+
+func (p *MemProducer) PublishMsgWithKeyContext(ctx context.Context, key string, data interface{}, opts ...PublishOption) error {
+	return p.send(ctx, []string{key}, "", data, opts)
+}
+
+func (p *MemProducer) PublishAction(ctx context.Context, key string, action string, data interface{}, opts ...PublishOption) error {
+	return p.send(ctx, []string{key}, action, data, opts)
+}
+
+func (p *MemProducer) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+// MemConsumer 从 MemBroker 队列消费的 Subscriber，ack 语义与 Consumer 相同
+type MemConsumer struct {
+	Router
+	Config *ChannelConfig
+	Logger *log.Logger
+
+	queue      *memQueue
+	tag        string
+	deliveries chan amqp.Delivery
+	mu         sync.Mutex
+	closed     bool
+	done       chan struct{}
+	inflight   sync.WaitGroup
+}
+
+func (b *MemBroker) NewConsumer(cfg *ChannelConfig) *MemConsumer {
+	b.declareExchange(cfg)
+	q := b.declareQueue(cfg.Queue)
+	if cfg.Retry != nil {
+		parking := cfg.Retry.parkingQueue(q.name)
+		b.declareQueue(parking)
+		q.dlExchange, q.dlKey = "", parking
+	} else if cfg.DeadLetterExchange != "" {
+		q.dlExchange = cfg.DeadLetterExchange
+	}
+	for _, v := range cfg.Key {
+		b.bind(cfg.Exchange, q.name, v)
+	}
+
+	c := &MemConsumer{
+		Config:     cfg,
+		Logger:     prefixLogger(b.logger, "[mq-mem-"+cfg.Exchange+"] "),
+		queue:      q,
+		tag:        newMessageId(),
+		deliveries: make(chan amqp.Delivery),
+		done:       make(chan struct{}),
+	}
+	go c.forward()
+	return c
+}
+
+// forward 是 deliveries 唯一的发送方，Close 后退出并关闭 deliveries
+func (c *MemConsumer) forward() {
+	defer close(c.deliveries)
+	for {
+		d, ok, wait := c.queue.pop(c)
+		if !ok {
+			select {
+			case <-wait:
+				continue
+			case <-c.done:
+				return
+			}
+		}
+		if !c.Config.ManualAck {
+			c.queue.Ack(d.DeliveryTag, false)
+		}
+		select {
+		case c.deliveries <- d:
+		case <-c.done:
+			if c.Config.ManualAck {
+				c.queue.Nack(d.DeliveryTag, false, true)
+			}
+			return
+		}
+	}
+}
+
+func (c *MemConsumer) Deliveries() <-chan amqp.Delivery {
+	return c.deliveries
+}
+
+func (c *MemConsumer) Serve(ctx context.Context, handler Handler) error {
+	if !c.Config.ManualAck {
+		return ErrAutoAck
+	}
+	return serve(ctx, c.Config, c.deliveries, c.done, c.begin, func(ctx context.Context, d amqp.Delivery) {
+		settle(c.Logger, d, invoke(ContextWithMetadata(ctx, d), handler, d), c.Config.deadLettered(), nil)
+		c.inflight.Done()
+	})
+}
+
+// begin 未登记的消息在 Close 时重新入队
+func (c *MemConsumer) begin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.inflight.Add(1)
+	return true
+}
+
+// Close 等待处理中的消息完成，未确认的消息重新入队，Deliveries 随后被关闭
+func (c *MemConsumer) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	c.mu.Unlock()
+
+	err := wait(ctx, &c.inflight)
+	c.queue.mu.Lock()
+	var ds []amqp.Delivery
+	for t, v := range c.queue.unacked {
+		if v.owner == c {
+			ds = append(ds, v.d)
+			delete(c.queue.unacked, t)
+		}
+	}
+	c.queue.mu.Unlock()
+	c.queue.requeue(ds)
+	return err
+}
+
+// WaitIdle 等待队列中的消息全部被消费并确认，用于测试中断言处理结果
+func (b *MemBroker) WaitIdle(ctx context.Context, queue string) error {
+	for {
+		b.mu.Lock()
+		q, ok := b.queues[queue]
+		b.mu.Unlock()
+		if ok {
+			q.mu.Lock()
+			idle := len(q.ready) == 0 && len(q.unacked) == 0
+			q.mu.Unlock()
+			if idle {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
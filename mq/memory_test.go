@@ -0,0 +1,252 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"a.b.c", "a.b.c", true},
+		{"a.b.c", "a.b", false},
+		{"a.*.c", "a.b.c", true},
+		{"a.*.c", "a.c", false},
+		{"a.*", "a.b.c", false},
+		{"*.*", "a.b", true},
+		{"#", "", true},
+		{"#", "a.b.c", true},
+		{"a.#", "a", true},
+		{"a.#", "a.b.c", true},
+		{"a.#", "b.a", false},
+		{"#.c", "a.b.c", true},
+		{"#.c", "c", true},
+		{"a.#.c", "a.c", true},
+		{"a.#.c", "a.b.b.c", true},
+		{"a.#.c", "a.b.d", false},
+		{"#.*", "", false},
+		{"#.*", "a", true},
+	}
+	for _, tt := range tests {
+		var words []string
+		if tt.key != "" {
+			words = strings.Split(tt.key, ".")
+		}
+		if got := topicMatch(strings.Split(tt.pattern, "."), words); got != tt.want {
+			t.Errorf("topicMatch(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMemConsumerCloseEndsRange(t *testing.T) {
+	b := NewMemBroker()
+	c := b.NewConsumer(&ChannelConfig{Queue: "jobs"})
+	b.Publish("", "jobs", amqp.Publishing{Body: []byte("x")})
+
+	received := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		for range c.Deliveries() {
+			close(received)
+		}
+		close(done)
+	}()
+	<-received
+	c.Close(context.Background())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("range over Deliveries did not end after Close")
+	}
+}
+
+// receive 读取 n 条消息，之后 50ms 内不应再收到消息
+func receive(t *testing.T, c *MemConsumer, n int) []amqp.Delivery {
+	t.Helper()
+	var ds []amqp.Delivery
+	for len(ds) < n {
+		select {
+		case d := <-c.Deliveries():
+			ds = append(ds, d)
+		case <-time.After(time.Second):
+			t.Fatalf("%s: received %d deliveries, want %d", c.Config.Queue, len(ds), n)
+		}
+	}
+	select {
+	case d := <-c.Deliveries():
+		t.Fatalf("%s: unexpected delivery %s", c.Config.Queue, d.RoutingKey)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return ds
+}
+
+func TestMemBrokerRouting(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		exchange string
+		keys     map[string][]string
+		key      string
+		want     map[string]int
+	}{
+		{"direct", amqp.ExchangeDirect, "ex", map[string][]string{"a": {"k1"}, "b": {"k2"}}, "k1", map[string]int{"a": 1, "b": 0}},
+		{"direct no match", amqp.ExchangeDirect, "ex", map[string][]string{"a": {"k1"}}, "k3", map[string]int{"a": 0}},
+		{"fanout", amqp.ExchangeFanout, "ex", map[string][]string{"a": {""}, "b": {"x"}}, "any", map[string]int{"a": 1, "b": 1}},
+		{"topic", amqp.ExchangeTopic, "ex", map[string][]string{"a": {"order.*"}, "b": {"#.paid"}, "c": {"user.#"}}, "order.paid", map[string]int{"a": 1, "b": 1, "c": 0}},
+		{"topic multiple bindings once", amqp.ExchangeTopic, "ex", map[string][]string{"a": {"order.*", "#"}}, "order.paid", map[string]int{"a": 1}},
+		{"default exchange", amqp.ExchangeDirect, "", map[string][]string{"a": nil, "b": nil}, "a", map[string]int{"a": 1, "b": 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemBroker()
+			consumers := map[string]*MemConsumer{}
+			for queue, keys := range tt.keys {
+				c := b.NewConsumer(&ChannelConfig{Type: tt.kind, Exchange: tt.exchange, Queue: queue, Key: keys})
+				defer c.Close(context.Background())
+				consumers[queue] = c
+			}
+			p := b.NewProducer(&ChannelConfig{Type: tt.kind, Exchange: tt.exchange})
+			if err := p.PublishMsgWithKey(tt.key, "hello"); err != nil {
+				t.Fatal(err)
+			}
+			for queue, n := range tt.want {
+				for _, d := range receive(t, consumers[queue], n) {
+					if d.RoutingKey != tt.key || string(d.Body) != `"hello"` {
+						t.Errorf("%s: delivery %s %s", queue, d.RoutingKey, d.Body)
+					}
+				}
+			}
+		})
+	}
+
+	if err := NewMemBroker().Publish("missing", "k", amqp.Publishing{}); err == nil {
+		t.Error("publish to undeclared exchange succeeded")
+	}
+}
+
+func TestMemServeAckAndRequeue(t *testing.T) {
+	b := NewMemBroker()
+	c := b.NewConsumer(&ChannelConfig{Queue: "jobs", ManualAck: true})
+	c.Logger = log.New(io.Discard, "", 0)
+	defer c.Close(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu          sync.Mutex
+		redelivered []bool
+	)
+	go c.Serve(ctx, func(ctx context.Context, d amqp.Delivery) error {
+		mu.Lock()
+		defer mu.Unlock()
+		redelivered = append(redelivered, d.Redelivered)
+		if len(redelivered) == 1 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+	b.NewProducer(&ChannelConfig{}).PublishMsgWithKey("jobs", "x")
+
+	wctx, wcancel := context.WithTimeout(ctx, time.Second)
+	defer wcancel()
+	if err := b.WaitIdle(wctx, "jobs"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(redelivered) != 2 || redelivered[0] || !redelivered[1] {
+		t.Fatalf("redelivered = %v, want [false true]", redelivered)
+	}
+}
+
+func TestMemServeRejectDeadLetter(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    ChannelConfig
+		target string
+	}{
+		{"dead letter exchange", ChannelConfig{Queue: "jobs", ManualAck: true, DeadLetterExchange: "dlx"}, "dead"},
+		{"retry parking queue", ChannelConfig{Queue: "jobs", ManualAck: true, Retry: &RetryConfig{MaxAttempts: 3}}, "jobs.parking"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemBroker()
+			dead := b.NewConsumer(&ChannelConfig{Type: amqp.ExchangeFanout, Exchange: "dlx", Queue: "dead", Key: []string{""}})
+			dead.Close(context.Background())
+
+			cfg := tt.cfg
+			c := b.NewConsumer(&cfg)
+			c.Logger = log.New(io.Discard, "", 0)
+			defer c.Close(context.Background())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go c.Serve(ctx, func(ctx context.Context, d amqp.Delivery) error {
+				return Permanent(errors.New("bad message"))
+			})
+			b.Publish("", "jobs", amqp.Publishing{MessageId: "m1", Body: []byte("x")})
+
+			wctx, wcancel := context.WithTimeout(ctx, time.Second)
+			defer wcancel()
+			if err := b.WaitIdle(wctx, "jobs"); err != nil {
+				t.Fatal(err)
+			}
+			if n := b.QueueLen(tt.target); n != 1 {
+				t.Fatalf("%s has %d messages, want 1", tt.target, n)
+			}
+		})
+	}
+}
+
+func TestMemConsumerCloseRequeues(t *testing.T) {
+	b := NewMemBroker()
+	cfg := &ChannelConfig{Queue: "jobs", ManualAck: true}
+	c := b.NewConsumer(cfg)
+	b.Publish("", "jobs", amqp.Publishing{MessageId: "m1"})
+	d := receive(t, c, 1)[0]
+	if d.Redelivered {
+		t.Fatal("first delivery marked redelivered")
+	}
+
+	// 未确认的消息在 Close 后回到队列
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.QueueLen("jobs"); n != 1 {
+		t.Fatalf("queue length after Close = %d, want 1", n)
+	}
+	c = b.NewConsumer(cfg)
+	defer c.Close(context.Background())
+	d = receive(t, c, 1)[0]
+	if d.MessageId != "m1" || !d.Redelivered {
+		t.Fatalf("redelivery = %s, redelivered %v", d.MessageId, d.Redelivered)
+	}
+}
+
+func TestMemBrokerWaitIdle(t *testing.T) {
+	b := NewMemBroker()
+	c := b.NewConsumer(&ChannelConfig{Queue: "jobs", ManualAck: true})
+	defer c.Close(context.Background())
+	b.Publish("", "jobs", amqp.Publishing{})
+	d := receive(t, c, 1)[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.WaitIdle(ctx, "jobs"); err != context.DeadlineExceeded {
+		t.Fatalf("WaitIdle with unacked message = %v, want DeadlineExceeded", err)
+	}
+	d.Ack(false)
+	if err := b.WaitIdle(context.Background(), "jobs"); err != nil {
+		t.Fatal(err)
+	}
+}
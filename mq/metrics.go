@@ -0,0 +1,168 @@
+package mq
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics mq 的埋点接口，label 取自 ChannelConfig 的 Exchange/Queue
+type Metrics interface {
+	// Published 每次 basic.publish（含等待确认）结束时调用
+	Published(exchange string, d time.Duration, err error)
+	// Consumed 每收到一条消息时调用
+	Consumed(queue string)
+	// Settled Serve 确认消息时调用，outcome 为 ack、reject、retry、requeue 或 duplicate
+	Settled(queue string, outcome string)
+	// Handled Serve 中 handler 执行结束时调用
+	Handled(queue string, d time.Duration, err error)
+	// Reconnected 连接或 channel 重连成功时调用，kind 为 connection 或 channel
+	Reconnected(kind string)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) Published(string, time.Duration, error) {}
+func (noopMetrics) Consumed(string)                        {}
+func (noopMetrics) Settled(string, string)                 {}
+func (noopMetrics) Handled(string, time.Duration, error)   {}
+func (noopMetrics) Reconnected(string)                     {}
+
+// WithMetrics 设置 MQCLIENT.Metrics
+func WithMetrics(m Metrics) ClientOption {
+	return func(o *clientOptions) { o.metrics = m }
+}
+
+func (client *MQCLIENT) metrics() Metrics {
+	if client.Metrics == nil {
+		return noopMetrics{}
+	}
+	return client.Metrics
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// PromMetrics 默认的 Metrics 实现，ServeHTTP 以 Prometheus 文本格式输出：
+// mq_published_total、mq_publish_duration_seconds、mq_consumed_total、mq_settled_total、
+// mq_handler_duration_seconds、mq_reconnects_total
+type PromMetrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+func NewPromMetrics() *PromMetrics {
+	return &PromMetrics{
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+func labels(kv ...string) string {
+	parts := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, kv[i], v))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *PromMetrics) inc(name, labels string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counters[name] == nil {
+		m.counters[name] = make(map[string]float64)
+	}
+	m.counters[name][labels]++
+}
+
+func (m *PromMetrics) observe(name, labels string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.histograms[name] == nil {
+		m.histograms[name] = make(map[string]*histogram)
+	}
+	h, ok := m.histograms[name][labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(defaultBuckets))}
+		m.histograms[name][labels] = h
+	}
+	v := d.Seconds()
+	for i, b := range defaultBuckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (m *PromMetrics) Published(exchange string, d time.Duration, err error) {
+	m.inc("mq_published_total", labels("exchange", exchange, "result", result(err)))
+	m.observe("mq_publish_duration_seconds", labels("exchange", exchange), d)
+}
+
+func (m *PromMetrics) Consumed(queue string) {
+	m.inc("mq_consumed_total", labels("queue", queue))
+}
+
+func (m *PromMetrics) Settled(queue string, outcome string) {
+	m.inc("mq_settled_total", labels("queue", queue, "outcome", outcome))
+}
+
+func (m *PromMetrics) Handled(queue string, d time.Duration, err error) {
+	m.observe("mq_handler_duration_seconds", labels("queue", queue, "result", result(err)), d)
+}
+
+func (m *PromMetrics) Reconnected(kind string) {
+	m.inc("mq_reconnects_total", labels("kind", kind))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *PromMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range sortedKeys(m.counters) {
+		fmt.Fprintf(w, "# TYPE %s counter\n", name)
+		for _, l := range sortedKeys(m.counters[name]) {
+			fmt.Fprintf(w, "%s{%s} %g\n", name, l, m.counters[name][l])
+		}
+	}
+	for _, name := range sortedKeys(m.histograms) {
+		fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+		for _, l := range sortedKeys(m.histograms[name]) {
+			h := m.histograms[name][l]
+			for i, b := range defaultBuckets {
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", name, l, b, h.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, h.count)
+			fmt.Fprintf(w, "%s_sum{%s} %g\n", name, l, h.sum)
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, l, h.count)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package mq
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"log"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/streadway/amqp"
@@ -16,11 +17,67 @@ type ChannelConfig struct {
 	Queue    string   `json:"queue"`
 	Key      []string `json:"key"`
 	Durable  bool     `json:"durable"`
+	// Confirm 开启 publisher confirms，发送消息会阻塞直到 broker 返回 ack/nack
+	Confirm bool `json:"confirm"`
+	// ConfirmTimeout 等待确认的超时时间（秒），未设置时使用 defaultConfirmTimeout
+	ConfirmTimeout int `json:"confirm_timeout"`
+	// Mandatory 以 mandatory=true 发送，无法路由的消息由 broker 通过 basic.return 退回：
+	// 开启 Confirm 时发送返回 *ReturnError，否则交给 Producer.OnReturn
+	Mandatory bool `json:"mandatory"`
+	// ManualAck 关闭 auto ack，配合 Consumer.Serve 由 handler 的返回值决定 Ack/Nack/Reject
+	ManualAck bool `json:"manual_ack"`
+	// Qos 每个消费者未确认消息的最大数量（prefetch count），0 表示不限制
+	Qos int `json:"qos"`
+	// DeadLetterExchange 队列的 x-dead-letter-exchange，被 Reject 的消息会转发到该 exchange
+	DeadLetterExchange string `json:"dead_letter_exchange"`
+	// Retry 配置后自动声明延迟重试队列和 parking-lot 队列，优先于 DeadLetterExchange
+	Retry *RetryConfig `json:"retry"`
+	// QueueType 队列类型 classic、quorum 或 stream，为空时使用 broker 默认（classic）
+	QueueType string `json:"queue_type"`
+	// AutoDelete 无消费者时删除队列，未设置时 classic 队列为 true，quorum/stream 队列为 false
+	AutoDelete *bool `json:"auto_delete"`
+	Exclusive  bool  `json:"exclusive"`
+	// Arguments 声明队列时的额外参数，如 x-max-length、x-max-age
+	Arguments map[string]interface{} `json:"arguments"`
+	// StreamOffset stream 队列的起始位置：first、last、next、数字 offset 或 RFC3339 时间，重连后从最后收到的消息之后继续
+	StreamOffset string `json:"stream_offset"`
+	// Workers Serve 并发处理消息的 worker 数，分区 key 相同的消息由同一个 worker 按顺序处理；Qos 应不小于 Workers
+	Workers int `json:"workers"`
+	// PartitionHeader 分区 key 取自该消息头，为空时使用 routing key
+	PartitionHeader string `json:"partition_header"`
+	// Dedup 配置后 Consumer.Serve 按 MessageId 或指定消息头去重，存储由 Consumer.DedupStore 提供，默认进程内存储
+	Dedup *DedupConfig `json:"dedup"`
+	// Delay PublishAt/PublishAfter 的实现方式：plugin 使用 x-delayed-message 插件，ttl（默认）使用按延迟时间声明的 TTL 队列；
+	// 插件未安装时声明 x-delayed-message exchange 会导致 broker 关闭整个连接，因此不做自动检测
+	Delay string `json:"delay"`
+	// DelayPrecision ttl 方式下延迟时间向上取整的粒度（秒），每个不同的延迟时间对应一个队列；
+	// 默认按延迟长短取整：1 分钟内 1 秒，1 小时内 10 秒，更长 1 分钟
+	DelayPrecision int `json:"delay_precision"`
+	// Outbox 配置后 Producer 发送失败的消息写入本地文件，连接恢复后按顺序重发
+	Outbox *OutboxConfig `json:"outbox"`
 }
 
 type MQCLIENT struct {
 	Conn *amqp.Connection
 	Lock sync.Mutex
+	// PoolSize 发送消息的 channel 池大小，0 时为 CPU 核数
+	PoolSize int
+	// Metrics 埋点，为空时不记录
+	Metrics Metrics
+
+	config      *ConnConfig
+	amqpConfig  amqp.Config
+	node        int
+	notifyClose chan *amqp.Error
+	producers   []*Producer
+	consumers   []*Consumer
+	poolOnce    sync.Once
+	channels    *channelPool
+	closed      bool
+	retry       RetryPolicy
+	logger      Logger
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
 type MQCHANNEL struct {
@@ -28,12 +85,29 @@ type MQCHANNEL struct {
 }
 
 type Consumer struct {
+	Router
 	Client      *MQCLIENT
 	Channel     *amqp.Channel
 	Logger      *log.Logger
 	RdData      <-chan amqp.Delivery
 	NotifyClose chan *amqp.Error
 	Config      *ChannelConfig
+	// DedupStore Config.Dedup 的存储，为空时 Serve 使用 MemoryDedupStore
+	DedupStore DedupStore
+
+	mu         sync.Mutex
+	deliveries chan amqp.Delivery
+	tag        string
+	nextOffset int64
+	retryMu    sync.Mutex
+	retryPub   *pubChannel
+	closed     bool
+	done       chan struct{}
+	inflight   sync.WaitGroup
+	// forwarders 各 channel 的 forward goroutine，全部退出后 Close 关闭 RdData
+	forwarders sync.WaitGroup
+	// reconnecting 同一时间只有一个重连循环，channel 关闭和连接恢复可能同时触发
+	reconnecting int32
 }
 
 type Producer struct {
@@ -42,6 +116,20 @@ type Producer struct {
 	Logger      *log.Logger
 	NotifyClose chan *amqp.Error
 	Config      *ChannelConfig
+	// Codec 消息体编码方式，默认 JSONCodec
+	Codec Codec
+	// OnReturn 处理 Mandatory 模式下被退回且无法对应到发送调用的消息，为空时记录日志
+	OnReturn func(amqp.Return)
+
+	mu           sync.Mutex
+	own          *pubChannel
+	setup        func(ch *amqp.Channel) error
+	outbox       *outbox
+	delay        delayState
+	closed       bool
+	done         chan struct{}
+	inflight     sync.WaitGroup
+	reconnecting int32
 }
 
 type PublishMsg struct {
@@ -59,103 +147,329 @@ const (
 	reconnectDelay = 15 * time.Second
 )
 
+// NewConnect 连接MQ，失败时每 reconnectDelay 重试一次直到成功
 func NewConnect(path string) *amqp.Connection {
-	conn, err := amqp.Dial(path)
+	conn, _, _ := dial(context.Background(), []string{path}, 0, amqp.Config{}, legacyRetryPolicy, newLogger(""))
+	return conn
+}
+
+// NewClient 连接MQ，连接断开后自动重连并恢复所有已注册的 Producer 和 Consumer；连接失败时一直阻塞重试
+func NewClient(path string) *MQCLIENT {
+	client, _ := Dial(context.Background(), path, WithRetryPolicy(legacyRetryPolicy))
+	return client
+}
+
+// Dial 与 NewClient 相同，但按 RetryPolicy 重试，重试用尽或 ctx 结束时返回错误；断线重连时不受 MaxAttempts 限制
+func Dial(ctx context.Context, path string, opts ...ClientOption) (*MQCLIENT, error) {
+	return DialConfig(ctx, &ConnConfig{URLs: []string{path}}, opts...)
+}
+
+// DialConfig 按 ConnConfig 连接，URLs 中的节点依次轮流尝试，断线重连时从下一个节点开始
+func DialConfig(ctx context.Context, cfg *ConnConfig, opts ...ClientOption) (*MQCLIENT, error) {
+	o := clientOptions{retry: DefaultRetryPolicy}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("mq: no url in ConnConfig")
+	}
+	amqpConfig, err := cfg.amqpConfig()
+	if err != nil {
+		return nil, err
+	}
+	client := &MQCLIENT{config: cfg, amqpConfig: amqpConfig, retry: o.retry, logger: o.logger, Metrics: o.metrics}
+	conn, node, err := dial(ctx, cfg.URLs, 0, amqpConfig, client.retry, client.log())
 	if err != nil {
-		log.Printf("MQ Client error: %s", err.Error())
-		for {
-			time.Sleep(reconnectDelay)
-			log.Println("MQ Client reconnet")
-			conn, err = amqp.Dial(path)
-			if err == nil {
-				break
-			}
+		return nil, err
+	}
+	client.node = node
+	client.setConn(conn)
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	go client.keepAlive()
+	return client, nil
+}
+
+func (client *MQCLIENT) log() Logger {
+	if client.logger != nil {
+		return client.logger
+	}
+	return newLogger("[mq] ")
+}
+
+func (client *MQCLIENT) newLogger(prefix string) *log.Logger {
+	return prefixLogger(client.logger, prefix)
+}
+
+func (client *MQCLIENT) retryPolicy() RetryPolicy {
+	if client.retry == (RetryPolicy{}) {
+		return legacyRetryPolicy
+	}
+	return client.retry
+}
+
+// reconnectPolicy 断线后一直重试直到 Close
+func (client *MQCLIENT) reconnectPolicy() RetryPolicy {
+	policy := client.retryPolicy()
+	policy.MaxAttempts = 0
+	return policy
+}
+
+func (client *MQCLIENT) context() context.Context {
+	if client.ctx == nil {
+		return context.Background()
+	}
+	return client.ctx
+}
+
+// setConn 客户端已 Close 时不替换连接并返回 false，由调用方关闭 conn
+func (client *MQCLIENT) setConn(conn *amqp.Connection) bool {
+	client.Lock.Lock()
+	defer client.Lock.Unlock()
+	if client.closed {
+		return false
+	}
+	client.Conn = conn
+	client.notifyClose = conn.NotifyClose(make(chan *amqp.Error, 1))
+	return true
+}
+
+func (client *MQCLIENT) conn() *amqp.Connection {
+	client.Lock.Lock()
+	defer client.Lock.Unlock()
+	return client.Conn
+}
+
+// keepAlive 监听连接关闭，异常断开时重新建立连接，并对每个 Producer/Consumer 重新执行 handelConnect
+func (client *MQCLIENT) keepAlive() {
+	for {
+		client.Lock.Lock()
+		notify := client.notifyClose
+		client.Lock.Unlock()
+
+		err, ok := <-notify
+		if !ok || client.isClosed() {
+			return
+		}
+		client.log().Printf("MQ Client connection closed: %s", err.Error())
+		conn, node, err2 := dial(client.context(), client.config.URLs, client.node+1, client.amqpConfig, client.reconnectPolicy(), client.log())
+		if err2 != nil {
+			return
+		}
+		client.node = node
+		// 重连期间 Close 已关闭旧连接，新连接不再使用
+		if !client.setConn(conn) {
+			conn.Close()
+			return
+		}
+		client.metrics().Reconnected("connection")
+
+		client.Lock.Lock()
+		producers := append([]*Producer(nil), client.producers...)
+		consumers := append([]*Consumer(nil), client.consumers...)
+		client.Lock.Unlock()
+
+		// 每个 Producer/Consumer 单独重连，某个 channel 一直失败（如队列参数变化导致 406）不影响其他的恢复
+		for _, p := range producers {
+			go p.reconnect()
+		}
+		for _, c := range consumers {
+			go c.reconnect()
 		}
 	}
-	log.Println("MQ Client seccess")
-	return conn
 }
 
+// NewChannel 打开失败时记录日志并返回 nil，需要处理错误时使用 OpenChannel
 func (client *MQCLIENT) NewChannel() *MQCHANNEL {
-	ch, err := client.Conn.Channel()
+	ch, err := client.OpenChannel()
 	if err != nil {
-		log.Fatalln(err.Error())
+		client.log().Printf("MQ Client open channel: %s", err.Error())
+		return nil
 	}
-	return &MQCHANNEL{ch}
+	return ch
 }
 
+func (client *MQCLIENT) OpenChannel() (*MQCHANNEL, error) {
+	ch, err := client.conn().Channel()
+	if err != nil {
+		return nil, err
+	}
+	return &MQCHANNEL{ch}, nil
+}
+
+// NewProducer 打开 channel 失败时一直重试（不受 RetryPolicy.MaxAttempts 限制），需要处理错误时使用 NewProducerContext
 func (client *MQCLIENT) NewProducer(cfg *ChannelConfig) *Producer {
-	p := Producer{
+	p, err := client.newProducer(context.Background(), cfg, nil, client.reconnectPolicy())
+	if err != nil {
+		client.log().Printf("MQ Client new producer: %s", err.Error())
+	}
+	return p
+}
+
+// NewProducerContext 按 RetryPolicy 打开 channel 并声明 exchange，失败时返回错误
+func (client *MQCLIENT) NewProducerContext(ctx context.Context, cfg *ChannelConfig) (*Producer, error) {
+	return client.newProducer(ctx, cfg, nil, client.retryPolicy())
+}
+
+// newProducer setup 在每次打开 channel 后执行，用于在同一 channel 上做额外的初始化（如 RPC 的 reply-to 订阅）
+func (client *MQCLIENT) newProducer(ctx context.Context, cfg *ChannelConfig, setup func(ch *amqp.Channel) error, policy RetryPolicy) (*Producer, error) {
+	p := &Producer{
 		Config: cfg,
 		Client: client,
-		Logger: log.New(os.Stdout, "[mq-"+cfg.Exchange+"] ", log.LstdFlags|log.Lshortfile),
+		Logger: client.newLogger("[mq-" + cfg.Exchange + "] "),
+		setup:  setup,
+		done:   make(chan struct{}),
 	}
-
-	for !p.handelConnect() {
-		p.Logger.Printf("Failed to open channel. Retrying...")
-		time.Sleep(reconnectDelay)
+	if err := policy.Do(ctx, p.Logger, "Open channel", p.handelConnect); err != nil {
+		return nil, err
+	}
+	if cfg.Outbox != nil {
+		ob, err := openOutbox(cfg.Outbox)
+		if err != nil {
+			p.Channel.Close()
+			return nil, err
+		}
+		p.outbox = ob
+		go p.replayOutbox()
 	}
+	client.Lock.Lock()
+	client.producers = append(client.producers, p)
+	client.Lock.Unlock()
 	p.Logger.Printf("Producer type:%s, exchange:%s, queue:%s, key:%s  \n", cfg.Type, cfg.Exchange, cfg.Queue, cfg.Key)
-	return &p
+	return p, nil
 }
 
+// NewConsumer 打开 channel 失败时一直重试（不受 RetryPolicy.MaxAttempts 限制），需要处理错误时使用 NewConsumerContext
 func (client *MQCLIENT) NewConsumer(cfg *ChannelConfig) *Consumer {
-	c := Consumer{
-		Config: cfg,
-		Client: client,
-		Logger: log.New(os.Stdout, "[mq-"+cfg.Exchange+"] ", log.LstdFlags|log.Lshortfile),
+	c, err := client.newConsumer(context.Background(), cfg, client.reconnectPolicy())
+	if err != nil {
+		client.log().Printf("MQ Client new consumer: %s", err.Error())
 	}
+	return c
+}
 
-	for !c.handelConnect() {
-		c.Logger.Printf("Failed to open channel. Retrying...")
-		time.Sleep(reconnectDelay)
+// NewConsumerContext 按 RetryPolicy 打开 channel、声明队列并订阅，失败时返回错误
+func (client *MQCLIENT) NewConsumerContext(ctx context.Context, cfg *ChannelConfig) (*Consumer, error) {
+	return client.newConsumer(ctx, cfg, client.retryPolicy())
+}
+
+func (client *MQCLIENT) newConsumer(ctx context.Context, cfg *ChannelConfig, policy RetryPolicy) (*Consumer, error) {
+	c := &Consumer{
+		Config:     cfg,
+		Client:     client,
+		Logger:     client.newLogger("[mq-" + cfg.Exchange + "] "),
+		deliveries: make(chan amqp.Delivery),
+		done:       make(chan struct{}),
 	}
+	c.RdData = c.deliveries
+
+	if err := policy.Do(ctx, c.Logger, "Open channel", c.handelConnect); err != nil {
+		return nil, err
+	}
+	client.Lock.Lock()
+	client.consumers = append(client.consumers, c)
+	client.Lock.Unlock()
 	c.Logger.Printf("Consumer type:%s, exchange:%s, queue:%s, key:%s  \n", cfg.Type, cfg.Exchange, cfg.Queue, cfg.Key)
-	return &c
+	return c, nil
+}
+
+func declareExchange(ch *amqp.Channel, cfg *ChannelConfig) error {
+	return ch.ExchangeDeclare(
+		cfg.Exchange, // name
+		cfg.Type,     // type
+		cfg.Durable,  // durable
+		false,        // auto-deleted
+		false,        // internal
+		false,        // no-wait
+		nil,          // arguments
+	)
 }
 
-func (p *Producer) handelConnect() bool {
-	ch, err := p.Client.Conn.Channel()
+func (p *Producer) handelConnect() error {
+	conn := p.Client.conn()
+	ch, err := conn.Channel()
 	if err != nil {
-		p.Logger.Printf(err.Error())
-		return false
+		return err
 	}
 
-	err = ch.ExchangeDeclare(
-		p.Config.Exchange, // name
-		p.Config.Type,     // type
-		p.Config.Durable,  // durable
-		false,             // auto-deleted
-		false,             // internal
-		false,             // no-wait
-		nil,               // arguments
-	)
+	if err = declareExchange(ch, p.Config); err != nil {
+		return err
+	}
+
+	if p.setup != nil {
+		if err = p.setup(ch); err != nil {
+			return err
+		}
+	}
+
+	own, err := newPubChannel(ch, p.Config.Confirm, p.Config.Mandatory)
 	if err != nil {
-		p.Logger.Printf(err.Error())
-		return false
+		return err
+	}
+	if own.returns != nil && own.confirms == nil {
+		go p.handleReturns(own.returns)
 	}
-	p.NotifyClose = make(chan *amqp.Error)
+
+	p.mu.Lock()
+	p.own = own
+	p.NotifyClose = make(chan *amqp.Error, 1)
 	p.Channel = ch
 	p.Channel.NotifyClose(p.NotifyClose)
-	return true
+	go p.watch(conn, p.NotifyClose)
+	p.mu.Unlock()
+	return nil
+}
+
+// watch 处理单个 channel 异常关闭（连接仍可用）的情况，连接断开由 MQCLIENT.keepAlive 负责恢复
+func (p *Producer) watch(conn *amqp.Connection, notify chan *amqp.Error) {
+	err, ok := <-notify
+	if !ok || conn.IsClosed() {
+		return
+	}
+	p.Logger.Printf("Channel closed: %s", err.Error())
+	p.reconnect()
+}
+
+func (p *Producer) reconnect() {
+	if p.isClosed() || !atomic.CompareAndSwapInt32(&p.reconnecting, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&p.reconnecting, 0)
+	policy := p.Client.reconnectPolicy()
+	for attempt := 1; ; attempt++ {
+		err := p.handelConnect()
+		if err == nil {
+			break
+		}
+		if p.isClosed() || p.Client.conn().IsClosed() {
+			return
+		}
+		p.Logger.Printf("Failed to reopen channel: %s. Retrying...", err.Error())
+		if !sleep(p.Client.context(), p.done, policy.Delay(attempt)) {
+			return
+		}
+	}
+	p.Logger.Printf("Producer reconnected, exchange:%s", p.Config.Exchange)
+	p.Client.metrics().Reconnected("channel")
+	p.resetDelays()
+	if p.outbox != nil {
+		p.outbox.notify()
+	}
 }
 
 func (p *Producer) PublishMsg(data interface{}) error {
-	buf, err := json.Marshal(data)
+	ctx, cancel := context.WithTimeout(context.Background(), p.confirmTimeout())
+	defer cancel()
+	return p.PublishMsgContext(ctx, data)
+}
+
+// PublishMsgContext 向 Config.Key 中的每个 routing key 发送消息，开启 Confirm 时 ctx 控制等待确认的期限
+func (p *Producer) PublishMsgContext(ctx context.Context, data interface{}, opts ...PublishOption) error {
+	msg, err := newPublishing(ctx, p.codec(), "", data, opts)
 	if err != nil {
 		return err
 	}
 	for _, v := range p.Config.Key {
-		err := p.Channel.Publish(
-			p.Config.Exchange,
-			v,
-			false, //mandatory：true：如果exchange根据自身类型和消息routeKey无法找到一个符合条件的queue，那么会调用basic.return方法将消息返还给生产者。false：出现上述情形broker会直接将消息扔掉
-			false, //如果exchange在将消息route到queue(s)时发现对应的queue上没有消费者，那么这条消息不会放入队列中。当与消息routeKey关联的所有queue(一个或多个)都没有消费者时，该消息会通过basic.return方法返还给生产者。
-			amqp.Publishing{
-				ContentType: "text/plain",
-				Body:        buf,
-			})
-		if err != nil {
+		if err := p.send(ctx, v, msg); err != nil {
 			return err
 		}
 	}
@@ -163,54 +477,102 @@ func (p *Producer) PublishMsg(data interface{}) error {
 }
 
 func (p *Producer) PublishMsgWithKey(key string, data interface{}) error {
-	buf, err := json.Marshal(data)
+	ctx, cancel := context.WithTimeout(context.Background(), p.confirmTimeout())
+	defer cancel()
+	return p.PublishMsgWithKeyContext(ctx, key, data)
+}
+
+func (p *Producer) PublishMsgWithKeyContext(ctx context.Context, key string, data interface{}, opts ...PublishOption) error {
+	msg, err := newPublishing(ctx, p.codec(), "", data, opts)
 	if err != nil {
 		return err
 	}
-	err = p.Channel.Publish(
-		p.Config.Exchange,
-		key,
-		false, //mandatory：true：如果exchange根据自身类型和消息routeKey无法找到一个符合条件的queue，那么会调用basic.return方法将消息返还给生产者。false：出现上述情形broker会直接将消息扔掉
-		false, //如果exchange在将消息route到queue(s)时发现对应的queue上没有消费者，那么这条消息不会放入队列中。当与消息routeKey关联的所有queue(一个或多个)都没有消费者时，该消息会通过basic.return方法返还给生产者。
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        buf,
-		})
-	return err
+	return p.send(ctx, key, msg)
 }
 
-func (c *Consumer) handelConnect() bool {
-	ch, err := c.Client.Conn.Channel()
+// PublishAction 发送由 Consumer.Dispatch 路由的消息，action 写入 amqp.Publishing.Type
+func (p *Producer) PublishAction(ctx context.Context, key string, action string, data interface{}, opts ...PublishOption) error {
+	msg, err := newPublishing(ctx, p.codec(), action, data, opts)
 	if err != nil {
-		c.Logger.Printf(err.Error())
-		return false
+		return err
 	}
+	return p.send(ctx, key, msg)
+}
 
-	err = ch.ExchangeDeclare(
-		c.Config.Exchange, // name
-		c.Config.Type,     // type
-		c.Config.Durable,  // durable
-		false,             // auto-deleted
-		false,             // internal
-		false,             // no-wait
-		nil,               // arguments
-	)
+func (p *Producer) codec() Codec {
+	if p.Codec == nil {
+		return JSONCodec{}
+	}
+	return p.Codec
+}
+
+// publish 从 MQCLIENT 的 channel 池中取 channel 发送，可并发调用；
+// RPCClient 需要在自身 channel 上接收回复，Mandatory 需要在自身 channel 上接收 basic.return，这两种情况串行发送
+func (p *Producer) publish(ctx context.Context, exchange string, key string, msg amqp.Publishing) error {
+	if p.setup != nil || p.Config.Mandatory {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.publishOn(ctx, p.own, exchange, key, msg)
+	}
+	pool := p.Client.pool()
+	pc, err := pool.acquire(ctx, p.Config.Confirm)
 	if err != nil {
-		c.Logger.Printf(err.Error())
-		return false
+		return err
+	}
+	defer pool.release(pc)
+	return p.publishOn(ctx, pc, exchange, key, msg)
+}
+
+// publishOn 延迟消息发往中转 exchange，不以 mandatory 发送
+func (p *Producer) publishOn(ctx context.Context, pc *pubChannel, exchange string, key string, msg amqp.Publishing) (err error) {
+	defer func(start time.Time) {
+		p.Client.metrics().Published(exchange, time.Since(start), err)
+	}(time.Now())
+	mandatory := pc.returns != nil && exchange == p.Config.Exchange
+	err = pc.Publish(
+		exchange,
+		key,
+		mandatory, //mandatory：true：如果exchange根据自身类型和消息routeKey无法找到一个符合条件的queue，那么会调用basic.return方法将消息返还给生产者。false：出现上述情形broker会直接将消息扔掉
+		false,     //如果exchange在将消息route到queue(s)时发现对应的queue上没有消费者，那么这条消息不会放入队列中。当与消息routeKey关联的所有queue(一个或多个)都没有消费者时，该消息会通过basic.return方法返还给生产者。
+		msg)
+	if err != nil || pc.confirms == nil {
+		return err
+	}
+	pc.seq++
+	err = p.waitConfirm(ctx, pc, key, pc.seq)
+	if mandatory && (err == nil || errors.Is(err, ErrNacked)) {
+		if rerr := p.drainReturns(pc, msg.MessageId); rerr != nil {
+			return rerr
+		}
+	}
+	return err
+}
+func (c *Consumer) handelConnect() error {
+	conn := c.Client.conn()
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	if err = declareExchange(ch, c.Config); err != nil {
+		return err
 	}
 
+	if c.Config.Retry != nil {
+		if err = c.declareRetry(ch); err != nil {
+			return err
+		}
+	}
 	q, err := ch.QueueDeclare(
-		c.Config.Queue,   // name
-		c.Config.Durable, // durable
-		true,             // delete when unused
-		false,            // exclusive 是否私有
-		false,            // no-wait
-		nil,              // arguments
+		c.Config.Queue,             // name
+		c.Config.queueDurable(),    // durable
+		c.Config.queueAutoDelete(), // delete when unused
+		c.Config.Exclusive,         // exclusive 是否私有
+		false,                      // no-wait
+		c.Config.queueArgs(),       // arguments
 	)
 	if err != nil {
-		c.Logger.Printf(err.Error())
-		return false
+		return err
 	}
 
 	for _, v := range c.Config.Key {
@@ -222,30 +584,105 @@ func (c *Consumer) handelConnect() bool {
 			nil,
 		)
 		if err != nil {
-			c.Logger.Printf(err.Error())
-			return false
+			return err
 		}
 	}
 
+	if c.Config.Qos > 0 {
+		if err = ch.Qos(c.Config.Qos, 0, false); err != nil {
+			return err
+		}
+	}
+
+	consumeArgs, err := c.consumeArgs()
+	if err != nil {
+		return err
+	}
+
 	//订阅消息，并不是把mq的消息直接写到msgs，不需要死循环订阅，订阅之后mq有消息就会往msgs里写
+	tag := newMessageId()
 	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		true,   // auto ack
-		false,  // exclusive
-		false,  // no local
-		false,  // no wait
-		nil,    // args
+		q.Name,              // queue
+		tag,                 // consumer
+		!c.Config.ManualAck, // auto ack
+		false,               // exclusive
+		false,               // no local
+		false,               // no wait
+		consumeArgs,         // args
 	)
 
 	if err != nil {
-		c.Logger.Printf(err.Error())
-		return false
+		return err
 	}
 
-	c.NotifyClose = make(chan *amqp.Error)
+	c.mu.Lock()
+	// 重连期间 Close 已执行，新 channel 不再使用
+	if c.closed {
+		c.mu.Unlock()
+		ch.Close()
+		return ErrClosed
+	}
+	c.tag = tag
+	c.NotifyClose = make(chan *amqp.Error, 1)
 	c.Channel = ch
-	c.RdData = msgs
 	c.Channel.NotifyClose(c.NotifyClose)
-	return true
+	go c.watch(conn, c.NotifyClose)
+	c.forwarders.Add(1)
+	c.mu.Unlock()
+	go c.forward(msgs)
+	return nil
+}
+
+func (c *Consumer) channel() *amqp.Channel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Channel
+}
+
+// forward 将当前 channel 的消息转发到固定的 RdData，重连后调用方无需重新获取 RdData
+func (c *Consumer) forward(msgs <-chan amqp.Delivery) {
+	defer c.forwarders.Done()
+	for d := range msgs {
+		c.Client.metrics().Consumed(c.Config.Queue)
+		if offset, ok := d.Headers["x-stream-offset"].(int64); ok {
+			atomic.StoreInt64(&c.nextOffset, offset+1)
+		}
+		select {
+		case c.deliveries <- d:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Consumer) watch(conn *amqp.Connection, notify chan *amqp.Error) {
+	err, ok := <-notify
+	if !ok || conn.IsClosed() {
+		return
+	}
+	c.Logger.Printf("Channel closed: %s", err.Error())
+	c.reconnect()
+}
+
+func (c *Consumer) reconnect() {
+	if c.isClosed() || !atomic.CompareAndSwapInt32(&c.reconnecting, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&c.reconnecting, 0)
+	policy := c.Client.reconnectPolicy()
+	for attempt := 1; ; attempt++ {
+		err := c.handelConnect()
+		if err == nil {
+			break
+		}
+		if c.isClosed() || c.Client.conn().IsClosed() {
+			return
+		}
+		c.Logger.Printf("Failed to reopen channel: %s. Retrying...", err.Error())
+		if !sleep(c.Client.context(), c.done, policy.Delay(attempt)) {
+			return
+		}
+	}
+	c.Logger.Printf("Consumer reconnected, exchange:%s, queue:%s", c.Config.Exchange, c.Config.Queue)
+	c.Client.metrics().Reconnected("channel")
 }
@@ -0,0 +1,125 @@
+package mq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// TraceparentHeader W3C trace context 在消息头中的 key
+const TraceparentHeader = "traceparent"
+
+type PublishOption func(*amqp.Publishing)
+
+func WithHeaders(headers amqp.Table) PublishOption {
+	return func(m *amqp.Publishing) {
+		if m.Headers == nil {
+			m.Headers = amqp.Table{}
+		}
+		for k, v := range headers {
+			m.Headers[k] = v
+		}
+	}
+}
+
+func WithMessageId(id string) PublishOption {
+	return func(m *amqp.Publishing) { m.MessageId = id }
+}
+
+func WithCorrelationId(id string) PublishOption {
+	return func(m *amqp.Publishing) { m.CorrelationId = id }
+}
+
+// WithPriority 消息优先级 0-9，队列需要声明 x-max-priority 才会生效
+func WithPriority(priority uint8) PublishOption {
+	return func(m *amqp.Publishing) { m.Priority = priority }
+}
+
+// WithExpiration 消息在队列中的过期时间
+func WithExpiration(ttl time.Duration) PublishOption {
+	return func(m *amqp.Publishing) { m.Expiration = formatMillis(ttl) }
+}
+
+// WithPersistent 持久化消息，配合 durable 队列在 broker 重启后不丢失
+func WithPersistent() PublishOption {
+	return func(m *amqp.Publishing) { m.DeliveryMode = amqp.Persistent }
+}
+
+func WithTraceparent(traceparent string) PublishOption {
+	return WithHeaders(amqp.Table{TraceparentHeader: traceparent})
+}
+
+func formatMillis(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return strconv.FormatInt(int64(d/time.Millisecond), 10)
+}
+
+// Metadata 消费时消息的属性，通过 MetadataFromContext 在 handler 中获取
+type Metadata struct {
+	MessageId     string
+	CorrelationId string
+	Traceparent   string
+	Timestamp     time.Time
+	Exchange      string
+	RoutingKey    string
+	Redelivered   bool
+	Headers       amqp.Table
+}
+
+type metadataKey struct{}
+
+func MetadataFromContext(ctx context.Context) (*Metadata, bool) {
+	md, ok := ctx.Value(metadataKey{}).(*Metadata)
+	return md, ok
+}
+
+func ContextWithMetadata(ctx context.Context, d amqp.Delivery) context.Context {
+	traceparent, _ := d.Headers[TraceparentHeader].(string)
+	return context.WithValue(ctx, metadataKey{}, &Metadata{
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Traceparent:   traceparent,
+		Timestamp:     d.Timestamp,
+		Exchange:      d.Exchange,
+		RoutingKey:    d.RoutingKey,
+		Redelivered:   d.Redelivered,
+		Headers:       d.Headers,
+	})
+}
+
+// newPublishing 编码消息并补全 MessageId、Timestamp；ctx 来自消费的消息时继承 CorrelationId 和 traceparent
+func newPublishing(ctx context.Context, codec Codec, action string, data interface{}, opts []PublishOption) (amqp.Publishing, error) {
+	body, err := codec.Marshal(data)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+	msg := amqp.Publishing{
+		ContentType: codec.ContentType(),
+		Type:        action,
+		MessageId:   newMessageId(),
+		Timestamp:   time.Now(),
+		Body:        body,
+	}
+	if md, ok := MetadataFromContext(ctx); ok {
+		msg.CorrelationId = md.CorrelationId
+		if md.Traceparent != "" {
+			msg.Headers = amqp.Table{TraceparentHeader: md.Traceparent}
+		}
+	}
+	for _, opt := range opts {
+		opt(&msg)
+	}
+	return msg, nil
+}
+
+func newMessageId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
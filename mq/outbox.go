@@ -0,0 +1,286 @@
+package mq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var ErrOutboxFull = errors.New("outbox is full")
+
+// OutboxConfig 本地 outbox 文件配置，MaxBytes/MaxMessages 为 0 表示不限制
+type OutboxConfig struct {
+	Path        string `json:"path"`
+	MaxBytes    int64  `json:"max_bytes"`
+	MaxMessages int    `json:"max_messages"`
+}
+
+// OutboxStats outbox 中等待重发的消息
+type OutboxStats struct {
+	Pending int
+	Bytes   int64
+}
+
+type outboxRecord struct {
+	Key string
+	Msg amqp.Publishing
+}
+
+// 消息头中可能出现的 AMQP 类型，gob 编码 interface 值时需要注册
+func init() {
+	gob.Register(amqp.Table{})
+	gob.Register([]interface{}{})
+	gob.Register(time.Time{})
+	gob.Register(amqp.Decimal{})
+}
+
+// encodeRecord gob 编码保留消息头的 AMQP 类型（int32、嵌套 amqp.Table 等），再用 base64 编码为一行
+func encodeRecord(rec outboxRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return nil, err
+	}
+	line := make([]byte, base64.StdEncoding.EncodedLen(buf.Len())+1)
+	base64.StdEncoding.Encode(line, buf.Bytes())
+	line[len(line)-1] = '\n'
+	return line, nil
+}
+
+func decodeRecord(line []byte) (rec outboxRecord, err error) {
+	line = bytes.TrimSpace(line)
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(data, line)
+	if err != nil {
+		return
+	}
+	err = gob.NewDecoder(bytes.NewReader(data[:n])).Decode(&rec)
+	return
+}
+
+// outbox 追加写的消息文件，每行一条记录；已重发的位置保存在 <path>.offset，全部重发后清空文件。
+// 无法重发的记录移到 <path>.dead。
+type outbox struct {
+	cfg  *OutboxConfig
+	kick chan struct{}
+
+	mu      sync.Mutex
+	file    *os.File
+	offset  int64
+	size    int64
+	pending int
+}
+
+func openOutbox(cfg *OutboxConfig) (*outbox, error) {
+	f, err := os.OpenFile(cfg.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ob := &outbox{cfg: cfg, kick: make(chan struct{}, 1), file: f, size: st.Size()}
+	if buf, err := os.ReadFile(cfg.Path + ".offset"); err == nil {
+		ob.offset, _ = strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 64)
+		if ob.offset > ob.size {
+			ob.offset = ob.size
+		}
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, ob.offset, ob.size-ob.offset))
+	for {
+		if _, err := r.ReadBytes('\n'); err != nil {
+			break
+		}
+		ob.pending++
+	}
+	return ob, nil
+}
+
+func (ob *outbox) close() error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.file.Close()
+}
+
+func (ob *outbox) notify() {
+	select {
+	case ob.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (ob *outbox) stats() OutboxStats {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return OutboxStats{Pending: ob.pending, Bytes: ob.size - ob.offset}
+}
+
+func (ob *outbox) append(key string, msg amqp.Publishing) error {
+	buf, err := encodeRecord(outboxRecord{Key: key, Msg: msg})
+	if err != nil {
+		return err
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.cfg.MaxMessages > 0 && ob.pending >= ob.cfg.MaxMessages {
+		return ErrOutboxFull
+	}
+	if ob.cfg.MaxBytes > 0 && ob.size-ob.offset+int64(len(buf)) > ob.cfg.MaxBytes {
+		return ErrOutboxFull
+	}
+	if _, err = ob.file.Write(buf); err != nil {
+		return err
+	}
+	if err = ob.file.Sync(); err != nil {
+		return err
+	}
+	ob.size += int64(len(buf))
+	ob.pending++
+	return nil
+}
+
+// next 读取最早一条未重发的记录；记录无法解析时返回 err，调用方仍需 dead 并 commit 跳过
+func (ob *outbox) next() (rec outboxRecord, line []byte, ok bool, err error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.pending == 0 {
+		return
+	}
+	line, err = bufio.NewReader(io.NewSectionReader(ob.file, ob.offset, ob.size-ob.offset)).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	ok = true
+	rec, err = decodeRecord(line)
+	return
+}
+
+// dead 把无法重发的记录追加到 <path>.dead，供人工处理
+func (ob *outbox) dead(line []byte) error {
+	f, err := os.OpenFile(ob.cfg.Path+".dead", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (ob *outbox) commit(n int64) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.offset += n
+	ob.pending--
+	if ob.pending == 0 {
+		if err := ob.file.Truncate(0); err != nil {
+			return err
+		}
+		ob.offset, ob.size = 0, 0
+	}
+	return os.WriteFile(ob.cfg.Path+".offset", []byte(strconv.FormatInt(ob.offset, 10)), 0644)
+}
+
+// OutboxStats 返回 outbox 积压情况，未开启 outbox 时为空
+func (p *Producer) OutboxStats() OutboxStats {
+	if p.outbox == nil {
+		return OutboxStats{}
+	}
+	return p.outbox.stats()
+}
+
+// retryable 连接或 channel 断开、等待确认超时时重发可能成功；其他错误（nack、退回、消息头类型错误等）重发也不会成功
+func retryable(err error) bool {
+	if errors.Is(err, amqp.ErrClosed) || errors.Is(err, ErrConfirmTimeout) {
+		return true
+	}
+	var ae *amqp.Error
+	return errors.As(err, &ae) && ae.Recover
+}
+
+// send outbox 有积压时新消息直接追加到 outbox 以保证顺序；因连接问题发送失败的消息写入 outbox 并返回 nil
+func (p *Producer) send(ctx context.Context, key string, msg amqp.Publishing) error {
+	if !p.begin() {
+		return ErrClosed
+	}
+	defer p.inflight.Done()
+	if p.outbox == nil {
+		return p.publish(ctx, p.Config.Exchange, key, msg)
+	}
+	if p.outbox.stats().Pending == 0 {
+		err := p.publish(ctx, p.Config.Exchange, key, msg)
+		if err == nil || !retryable(err) {
+			return err
+		}
+		p.Logger.Printf("Publish failed, save to outbox: %s", err.Error())
+	}
+	if err := p.outbox.append(key, msg); err != nil {
+		return fmt.Errorf("save to outbox: %w", err)
+	}
+	return nil
+}
+
+func (p *Producer) replayOutbox() {
+	ticker := time.NewTicker(reconnectDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.outbox.kick:
+		case <-ticker.C:
+		case <-p.done:
+			return
+		}
+		p.drainOutbox()
+	}
+}
+
+func (p *Producer) drainOutbox() {
+	for {
+		rec, line, ok, err := p.outbox.next()
+		if !ok {
+			if err != nil {
+				p.Logger.Printf("Read outbox: %s", err.Error())
+			}
+			return
+		}
+		if err == nil {
+			if !p.begin() {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), p.confirmTimeout())
+			err = p.publish(ctx, p.Config.Exchange, rec.Key, rec.Msg)
+			cancel()
+			p.inflight.Done()
+			if err != nil && retryable(err) {
+				return
+			}
+		}
+		if err != nil {
+			p.Logger.Printf("Move outbox message to %s.dead: %s", p.outbox.cfg.Path, err.Error())
+			if err = p.outbox.dead(line); err != nil {
+				p.Logger.Printf("Write outbox dead letter: %s", err.Error())
+				return
+			}
+		}
+		if err = p.outbox.commit(int64(len(line))); err != nil {
+			p.Logger.Printf("Commit outbox: %s", err.Error())
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestOutboxReplay(t *testing.T) {
+	cfg := &OutboxConfig{Path: filepath.Join(t.TempDir(), "outbox")}
+	ob, err := openOutbox(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := ob.append(fmt.Sprint("key", i), amqp.Publishing{Body: []byte(fmt.Sprint(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec, line, ok, err := ob.next()
+	if !ok || err != nil || rec.Key != "key0" {
+		t.Fatalf("next = %q, %v, %v", rec.Key, ok, err)
+	}
+	if err := ob.commit(int64(len(line))); err != nil {
+		t.Fatal(err)
+	}
+	ob.close()
+
+	// 重启后从 offset 继续
+	ob, err = openOutbox(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.close()
+	if st := ob.stats(); st.Pending != 2 {
+		t.Fatalf("pending after reopen = %d, want 2", st.Pending)
+	}
+	for _, want := range []string{"key1", "key2"} {
+		rec, line, ok, err := ob.next()
+		if !ok || err != nil || rec.Key != want {
+			t.Fatalf("next = %q, %v, %v, want %s", rec.Key, ok, err, want)
+		}
+		if err := ob.commit(int64(len(line))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, ok, _ := ob.next(); ok {
+		t.Fatal("outbox not drained")
+	}
+	if st, _ := os.Stat(cfg.Path); st.Size() != 0 {
+		t.Fatalf("drained outbox size = %d, want 0", st.Size())
+	}
+}
+
+func TestOutboxHeaderTypes(t *testing.T) {
+	headers := amqp.Table{
+		"meta":  amqp.Table{"n": int32(1), "list": []interface{}{"a", int64(2)}},
+		"small": int16(3),
+		"at":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"nil":   nil,
+	}
+	line, err := encodeRecord(outboxRecord{Key: "k", Msg: amqp.Publishing{Headers: headers}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := decodeRecord(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Msg.Headers.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	meta, ok := rec.Msg.Headers["meta"].(amqp.Table)
+	if !ok {
+		t.Fatalf("meta = %T, want amqp.Table", rec.Msg.Headers["meta"])
+	}
+	if _, ok := meta["n"].(int32); !ok {
+		t.Errorf("meta.n = %T, want int32", meta["n"])
+	}
+	if _, ok := rec.Msg.Headers["small"].(int16); !ok {
+		t.Errorf("small = %T, want int16", rec.Msg.Headers["small"])
+	}
+}
+
+func TestOutboxFull(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  OutboxConfig
+	}{
+		{"messages", OutboxConfig{MaxMessages: 1}},
+		{"bytes", OutboxConfig{MaxBytes: 1000}},
+	}
+	for _, tt := range tests {
+		cfg := tt.cfg
+		cfg.Path = filepath.Join(t.TempDir(), "outbox")
+		ob, err := openOutbox(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ob.append("k", amqp.Publishing{}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := ob.append("k", amqp.Publishing{Body: make([]byte, 1000)}); !errors.Is(err, ErrOutboxFull) {
+			t.Errorf("%s: append = %v, want ErrOutboxFull", tt.name, err)
+		}
+		ob.close()
+	}
+}
+
+func TestOutboxDead(t *testing.T) {
+	cfg := &OutboxConfig{Path: filepath.Join(t.TempDir(), "outbox")}
+	ob, err := openOutbox(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.close()
+	ob.append("k", amqp.Publishing{})
+	_, line, _, _ := ob.next()
+	if err := ob.dead(line); err != nil {
+		t.Fatal(err)
+	}
+	ob.commit(int64(len(line)))
+	data, err := os.ReadFile(cfg.Path + ".dead")
+	if err != nil || string(data) != string(line) {
+		t.Fatalf("dead file = %q, %v", data, err)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{amqp.ErrClosed, true},
+		{&ConfirmError{Err: amqp.ErrClosed}, true},
+		{&ConfirmError{Err: ErrConfirmTimeout}, true},
+		{&amqp.Error{Code: amqp.ConnectionForced, Recover: true}, true},
+		{&amqp.Error{Code: amqp.PreconditionFailed}, false},
+		{&ConfirmError{Err: ErrNacked}, false},
+		{&ReturnError{}, false},
+		{errors.New("table field \"meta\" value map[string]interface {} not supported"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
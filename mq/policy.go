@@ -0,0 +1,129 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Logger mq 包使用的日志接口，*log.Logger 可直接使用
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// RetryPolicy 连接和打开 channel 的重试策略：第 n 次重试前等待 InitialDelay*Multiplier^(n-1)，
+// 不超过 MaxDelay，并在 ±Jitter 比例内随机抖动；MaxAttempts 为 0 时一直重试直到 ctx 结束
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	InitialDelay: time.Second,
+	MaxDelay:     reconnectDelay,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+// legacyRetryPolicy NewConnect/NewClient 等旧接口的行为：每 reconnectDelay 重试一次，永不放弃
+var legacyRetryPolicy = RetryPolicy{
+	InitialDelay: reconnectDelay,
+	MaxDelay:     reconnectDelay,
+	Multiplier:   1,
+}
+
+func (r RetryPolicy) Delay(attempt int) time.Duration {
+	d := float64(r.InitialDelay)
+	for i := 1; i < attempt; i++ {
+		d *= r.Multiplier
+		if r.MaxDelay > 0 && d > float64(r.MaxDelay) {
+			break
+		}
+	}
+	if r.MaxDelay > 0 && d > float64(r.MaxDelay) {
+		d = float64(r.MaxDelay)
+	}
+	if r.Jitter > 0 {
+		d += d * r.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// Do 执行 fn 直到成功、达到 MaxAttempts 或 ctx 结束，返回最后一次的错误
+func (r RetryPolicy) Do(ctx context.Context, logger Logger, name string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if r.MaxAttempts > 0 && attempt >= r.MaxAttempts {
+			return err
+		}
+		delay := r.Delay(attempt)
+		logger.Printf("%s failed: %s, retry in %s", name, err.Error(), delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// sleep 等待 d，ctx 结束或 done 关闭时提前返回 false
+func sleep(ctx context.Context, done <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-done:
+		return false
+	}
+}
+
+type clientOptions struct {
+	retry   RetryPolicy
+	logger  Logger
+	metrics Metrics
+}
+
+type ClientOption func(*clientOptions)
+
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(o *clientOptions) { o.retry = policy }
+}
+
+// WithLogger 替换默认输出到 stdout 的日志，Producer 和 Consumer 的 Logger 也输出到该日志
+func WithLogger(logger Logger) ClientOption {
+	return func(o *clientOptions) { o.logger = logger }
+}
+
+func newLogger(prefix string) *log.Logger {
+	return log.New(os.Stdout, prefix, log.LstdFlags|log.Lshortfile)
+}
+
+// loggerWriter 将 *log.Logger 的输出转给 Logger，Producer.Logger 等导出字段保持 *log.Logger 类型
+type loggerWriter struct {
+	logger Logger
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	w.logger.Printf("%s", bytes.TrimSuffix(p, []byte("\n")))
+	return len(p), nil
+}
+
+// prefixLogger logger 为空时输出到 stdout
+func prefixLogger(logger Logger, prefix string) *log.Logger {
+	if logger == nil {
+		return newLogger(prefix)
+	}
+	return log.New(loggerWriter{logger}, prefix, 0)
+}
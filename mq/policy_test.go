@@ -0,0 +1,54 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSleep(t *testing.T) {
+	if !sleep(context.Background(), nil, time.Millisecond) {
+		t.Fatal("sleep interrupted")
+	}
+
+	done := make(chan struct{})
+	close(done)
+	start := time.Now()
+	if sleep(context.Background(), done, time.Minute) {
+		t.Fatal("sleep not stopped by done")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if sleep(ctx, nil, time.Minute) {
+		t.Fatal("sleep not stopped by ctx")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("sleep waited for the full delay")
+	}
+}
+
+type recordLogger struct {
+	lines []string
+}
+
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestPrefixLogger(t *testing.T) {
+	rec := &recordLogger{}
+	prefixLogger(rec, "[mq-orders] ").Printf("Channel closed: %s", "EOF")
+	if len(rec.lines) != 1 || rec.lines[0] != "[mq-orders] Channel closed: EOF" {
+		t.Fatalf("lines = %q", rec.lines)
+	}
+
+	rec = &recordLogger{}
+	c := NewMemBroker(WithLogger(rec)).NewConsumer(&ChannelConfig{Queue: "jobs"})
+	defer c.Close(context.Background())
+	c.Logger.Printf("hello")
+	if len(rec.lines) != 1 || rec.lines[0] != "[mq-mem-] hello" {
+		t.Fatalf("MemConsumer lines = %q", rec.lines)
+	}
+}
@@ -0,0 +1,126 @@
+package mq
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// pubChannel 用于发送消息的 channel，同一时间只能被一个 goroutine 使用
+type pubChannel struct {
+	*amqp.Channel
+	confirm  bool
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+	seq      uint64
+	closed   chan *amqp.Error
+}
+
+func newPubChannel(ch *amqp.Channel, confirm bool, mandatory bool) (*pubChannel, error) {
+	pc := &pubChannel{Channel: ch, confirm: confirm}
+	if confirm {
+		if err := ch.Confirm(false); err != nil {
+			return nil, err
+		}
+		pc.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, confirmBuffer))
+	}
+	if mandatory {
+		pc.returns = ch.NotifyReturn(make(chan amqp.Return, confirmBuffer))
+	}
+	pc.closed = ch.NotifyClose(make(chan *amqp.Error, 1))
+	return pc, nil
+}
+
+func (pc *pubChannel) isClosed() bool {
+	select {
+	case <-pc.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// channelPool 限制同时用于发送的 channel 数量，空闲 channel 复用，已关闭的 channel（如重连后）直接丢弃
+type channelPool struct {
+	client *MQCLIENT
+	size   int
+	sem    chan struct{}
+
+	mu   sync.Mutex
+	idle []*pubChannel
+}
+
+func (client *MQCLIENT) pool() *channelPool {
+	client.poolOnce.Do(func() {
+		size := client.PoolSize
+		if size <= 0 {
+			size = runtime.NumCPU()
+		}
+		client.channels = &channelPool{
+			client: client,
+			size:   size,
+			sem:    make(chan struct{}, size),
+		}
+	})
+	return client.channels
+}
+
+func (pool *channelPool) acquire(ctx context.Context, confirm bool) (*pubChannel, error) {
+	select {
+	case pool.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	pool.mu.Lock()
+	for i := len(pool.idle) - 1; i >= 0; i-- {
+		pc := pool.idle[i]
+		if pc.confirm != confirm {
+			continue
+		}
+		pool.idle = append(pool.idle[:i], pool.idle[i+1:]...)
+		if pc.isClosed() {
+			continue
+		}
+		pool.mu.Unlock()
+		return pc, nil
+	}
+	pool.mu.Unlock()
+
+	ch, err := pool.client.conn().Channel()
+	if err == nil {
+		var pc *pubChannel
+		if pc, err = newPubChannel(ch, confirm, false); err == nil {
+			return pc, nil
+		}
+		ch.Close()
+	}
+	<-pool.sem
+	return nil, err
+}
+
+func (pool *channelPool) release(pc *pubChannel) {
+	defer func() { <-pool.sem }()
+	if pc.isClosed() {
+		return
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if len(pool.idle) >= pool.size {
+		old := pool.idle[0]
+		pool.idle = pool.idle[1:]
+		go old.Close()
+	}
+	pool.idle = append(pool.idle, pc)
+}
+
+func (pool *channelPool) close() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, pc := range pool.idle {
+		pc.Close()
+	}
+	pool.idle = nil
+}
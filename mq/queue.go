@@ -0,0 +1,121 @@
+package mq
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	QueueClassic = "classic"
+	QueueQuorum  = "quorum"
+	QueueStream  = "stream"
+)
+
+var ErrStreamAck = errors.New("stream queue requires ManualAck and Qos")
+
+// queueDurable quorum 和 stream 队列必须持久化
+func (cfg *ChannelConfig) queueDurable() bool {
+	return cfg.Durable || cfg.QueueType == QueueQuorum || cfg.QueueType == QueueStream
+}
+
+func (cfg *ChannelConfig) queueAutoDelete() bool {
+	if cfg.AutoDelete != nil {
+		return *cfg.AutoDelete
+	}
+	return cfg.QueueType != QueueQuorum && cfg.QueueType != QueueStream
+}
+
+func (cfg *ChannelConfig) queueArgs() amqp.Table {
+	args := amqp.Table{}
+	for k, v := range cfg.Arguments {
+		args[k] = amqpValue(v)
+	}
+	if cfg.QueueType != "" {
+		args["x-queue-type"] = cfg.QueueType
+	}
+	if cfg.Retry != nil {
+		args["x-dead-letter-exchange"] = ""
+		args["x-dead-letter-routing-key"] = cfg.Retry.parkingQueue(cfg.Queue)
+	} else if cfg.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = cfg.DeadLetterExchange
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// deadLettered 队列是否配置了死信，没有死信时 Reject 的消息会被 broker 丢弃
+func (cfg *ChannelConfig) deadLettered() bool {
+	return cfg.Retry != nil || cfg.DeadLetterExchange != ""
+}
+
+// consumeArgs stream 队列订阅时的 x-stream-offset
+func (c *Consumer) consumeArgs() (amqp.Table, error) {
+	if c.Config.QueueType != QueueStream {
+		return nil, nil
+	}
+	if !c.Config.ManualAck || c.Config.Qos <= 0 {
+		return nil, ErrStreamAck
+	}
+	if next := atomic.LoadInt64(&c.nextOffset); next > 0 {
+		return amqp.Table{"x-stream-offset": next}, nil
+	}
+	offset, err := parseStreamOffset(c.Config.StreamOffset)
+	if err != nil || offset == nil {
+		return nil, err
+	}
+	return amqp.Table{"x-stream-offset": offset}, nil
+}
+
+func parseStreamOffset(s string) (interface{}, error) {
+	switch s {
+	case "":
+		return nil, nil
+	case "first", "last", "next":
+		return s, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, errors.New("invalid stream offset " + s)
+	}
+	return t, nil
+}
+
+// amqpTable 转换 JSON/YAML 解析出的参数：整数值的 float64 转为 int64（RabbitMQ 不接受浮点数的 x-max-length 等参数），嵌套 map 转为 amqp.Table
+func amqpTable(m map[string]interface{}) amqp.Table {
+	if len(m) == 0 {
+		return nil
+	}
+	t := amqp.Table{}
+	for k, v := range m {
+		t[k] = amqpValue(v)
+	}
+	return t
+}
+
+func amqpValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v)
+		}
+	case map[string]interface{}:
+		return amqpTable(v)
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i := range v {
+			arr[i] = amqpValue(v[i])
+		}
+		return arr
+	}
+	return v
+}
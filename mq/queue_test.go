@@ -0,0 +1,59 @@
+package mq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestParseStreamOffset(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    interface{}
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"first", "first", false},
+		{"last", "last", false},
+		{"next", "next", false},
+		{"100", int64(100), false},
+		{"2024-01-02T03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"yesterday", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseStreamOffset(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStreamOffset(%q) err = %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseStreamOffset(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAmqpTable(t *testing.T) {
+	got := amqpTable(map[string]interface{}{
+		"x-max-length": float64(1000),
+		"ratio":        0.5,
+		"nested":       map[string]interface{}{"n": float64(1)},
+		"list":         []interface{}{float64(2), "a"},
+	})
+	want := amqp.Table{
+		"x-max-length": int64(1000),
+		"ratio":        0.5,
+		"nested":       amqp.Table{"n": int64(1)},
+		"list":         []interface{}{int64(2), "a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("amqpTable = %#v, want %#v", got, want)
+	}
+	if err := got.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if amqpTable(nil) != nil {
+		t.Fatal("amqpTable(nil) != nil")
+	}
+}
@@ -0,0 +1,164 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/streadway/amqp"
+)
+
+// RetryConfig 延迟重试拓扑：
+// 每个 Backoff 档位声明一个带 x-message-ttl 的重试队列，过期后经默认 exchange 回到主队列；
+// 超过 MaxAttempts 或 Reject 的消息进入 parking-lot 队列等待人工处理。
+type RetryConfig struct {
+	MaxAttempts int `json:"max_attempts"`
+	// Backoff 每次重试的等待时间（秒），重试次数超过档位数时使用最后一档
+	Backoff []int `json:"backoff"`
+	// DeadLetterQueue parking-lot 队列名，默认为 <queue>.parking
+	DeadLetterQueue string `json:"dead_letter_queue"`
+}
+
+func (r *RetryConfig) parkingQueue(queue string) string {
+	if r.DeadLetterQueue != "" {
+		return r.DeadLetterQueue
+	}
+	return queue + ".parking"
+}
+
+func (r *RetryConfig) retryQueue(queue string, attempt int) string {
+	i := attempt - 1
+	if i >= len(r.Backoff) {
+		i = len(r.Backoff) - 1
+	}
+	return fmt.Sprintf("%s.retry.%ds", queue, r.Backoff[i])
+}
+
+func (c *Consumer) declareRetry(ch *amqp.Channel) error {
+	queue := c.Config.Queue
+	if queue == "" {
+		return errors.New("retry requires a named queue")
+	}
+	if len(c.Config.Retry.Backoff) == 0 {
+		return errors.New("retry requires at least one backoff")
+	}
+	for _, v := range c.Config.Retry.Backoff {
+		_, err := ch.QueueDeclare(
+			fmt.Sprintf("%s.retry.%ds", queue, v), // name
+			c.Config.Durable,                      // durable
+			false,                                 // delete when unused
+			false,                                 // exclusive
+			false,                                 // no-wait
+			amqp.Table{
+				"x-message-ttl":             int64(v) * 1000,
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queue,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ch.QueueDeclare(
+		c.Config.Retry.parkingQueue(queue), // name
+		c.Config.Durable,                   // durable
+		false,                              // delete when unused
+		false,                              // exclusive
+		false,                              // no-wait
+		nil,                                // arguments
+	)
+	return err
+}
+
+// Attempts 根据 x-death 头统计消息已经过重试队列的次数
+func Attempts(d amqp.Delivery, queue string) int {
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	prefix := queue + ".retry."
+	count := 0
+	for _, v := range deaths {
+		death, ok := v.(amqp.Table)
+		if !ok {
+			continue
+		}
+		q, _ := death["queue"].(string)
+		if !strings.HasPrefix(q, prefix) {
+			continue
+		}
+		if n, ok := death["count"].(int64); ok {
+			count += int(n)
+		}
+	}
+	return count
+}
+
+// retry 将失败的消息转发到下一档重试队列，超过最大次数时转入 parking-lot 队列；
+// 转发以 confirm + mandatory 发送，broker 确认且未退回后才 Ack 原消息，否则重新入队
+func (c *Consumer) retry(d amqp.Delivery, cause error) error {
+	queue := c.Config.Queue
+	attempt := Attempts(d, queue) + 1
+	target := c.Config.Retry.retryQueue(queue, attempt)
+	if c.Config.Retry.MaxAttempts > 0 && attempt >= c.Config.Retry.MaxAttempts {
+		target = c.Config.Retry.parkingQueue(queue)
+	}
+	c.Logger.Printf("Retry message %d (attempt %d) to %s: %s", d.DeliveryTag, attempt, target, cause.Error())
+
+	if err := c.forwardRetry(target, amqp.Publishing{
+		Headers:         d.Headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}); err != nil {
+		// 转发失败时重新入队，避免消息丢失
+		c.Logger.Printf("Retry message %d to %s: %s", d.DeliveryTag, target, err.Error())
+		return d.Nack(false, true)
+	}
+	return d.Ack(false)
+}
+
+// forwardRetry 在独立的 channel 上串行转发，出错时关闭该 channel，避免残留的确认和退回影响下一次转发
+func (c *Consumer) forwardRetry(target string, msg amqp.Publishing) (err error) {
+	c.retryMu.Lock()
+	defer c.retryMu.Unlock()
+	if c.retryPub == nil || c.retryPub.isClosed() {
+		ch, err := c.Client.conn().Channel()
+		if err != nil {
+			return err
+		}
+		if c.retryPub, err = newPubChannel(ch, true, true); err != nil {
+			ch.Close()
+			return err
+		}
+	}
+	pc := c.retryPub
+	defer func() {
+		if err != nil {
+			pc.Close()
+			c.retryPub = nil
+		}
+	}()
+	if err = pc.Publish("", target, true, false, msg); err != nil {
+		return err
+	}
+	pc.seq++
+	if err = confirmed(context.Background(), pc, pc.seq, defaultConfirmTimeout); err != nil {
+		return err
+	}
+	// broker 在 ack 之前发送 basic.return
+	select {
+	case r := <-pc.returns:
+		return &ReturnError{Exchange: r.Exchange, Key: r.RoutingKey, ReplyCode: r.ReplyCode, ReplyText: r.ReplyText}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,29 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestAttempts(t *testing.T) {
+	death := func(queue string, count int64) amqp.Table {
+		return amqp.Table{"queue": queue, "count": count}
+	}
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{"no header", nil, 0},
+		{"one tier", amqp.Table{"x-death": []interface{}{death("orders.retry.1", 1)}}, 1},
+		{"tiers summed", amqp.Table{"x-death": []interface{}{death("orders.retry.2", 1), death("orders.retry.1", 2)}}, 3},
+		{"other queues ignored", amqp.Table{"x-death": []interface{}{death("orders", 4), death("users.retry.1", 1)}}, 0},
+		{"bad entries ignored", amqp.Table{"x-death": []interface{}{"x", amqp.Table{"queue": "orders.retry.1", "count": "1"}}}, 0},
+	}
+	for _, tt := range tests {
+		if got := Attempts(amqp.Delivery{Headers: tt.headers}, "orders"); got != tt.want {
+			t.Errorf("%s: Attempts = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
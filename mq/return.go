@@ -0,0 +1,61 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/streadway/amqp"
+)
+
+var ErrUnroutable = errors.New("message returned by broker")
+
+// ReturnError Mandatory 且开启 Confirm 时，消息无法路由被 broker 退回
+type ReturnError struct {
+	Exchange  string
+	Key       string
+	ReplyCode uint16
+	ReplyText string
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("mq return exchange:%s, key:%s: %d %s", e.Exchange, e.Key, e.ReplyCode, e.ReplyText)
+}
+
+func (e *ReturnError) Unwrap() error {
+	return ErrUnroutable
+}
+
+// drainReturns broker 在 ack 之前发送 basic.return，确认后缓冲中已包含本条消息的退回；
+// 与 messageId 对应的返回 *ReturnError，其余（之前超时的发送）交给 OnReturn
+func (p *Producer) drainReturns(pc *pubChannel, messageId string) error {
+	var err error
+	for {
+		select {
+		case r, ok := <-pc.returns:
+			if !ok {
+				return err
+			}
+			if err == nil && r.MessageId == messageId {
+				err = &ReturnError{Exchange: r.Exchange, Key: r.RoutingKey, ReplyCode: r.ReplyCode, ReplyText: r.ReplyText}
+				continue
+			}
+			p.onReturn(r)
+		default:
+			return err
+		}
+	}
+}
+
+func (p *Producer) handleReturns(returns chan amqp.Return) {
+	for r := range returns {
+		p.onReturn(r)
+	}
+}
+
+func (p *Producer) onReturn(r amqp.Return) {
+	if p.OnReturn != nil {
+		p.OnReturn(r)
+		return
+	}
+	p.Logger.Printf("Message %s returned, exchange:%s, key:%s: %d %s", r.MessageId, r.Exchange, r.RoutingKey, r.ReplyCode, r.ReplyText)
+}
@@ -0,0 +1,78 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+var ErrUnknownAction = errors.New("unknown action")
+
+type routeFunc func(ctx context.Context, codec Codec, data []byte) error
+
+// Router 按 action 分发消息，嵌入在 Consumer 和 MemConsumer 中
+type Router struct {
+	mu     sync.Mutex
+	routes map[string]routeFunc
+}
+
+func (r *Router) router() *Router {
+	return r
+}
+
+// Routable 可以通过 Handle 注册 action 的消费者
+type Routable interface {
+	router() *Router
+}
+
+// Handle 为 Consumer 注册 action 的处理函数，消息的 Data 按 ContentType 对应的 Codec 解码为 *T
+func Handle[T any](c Routable, action string, fn func(ctx context.Context, msg *T) error) {
+	r := c.router()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.routes == nil {
+		r.routes = make(map[string]routeFunc)
+	}
+	r.routes[action] = func(ctx context.Context, codec Codec, data []byte) error {
+		msg := new(T)
+		if len(data) > 0 {
+			if err := codec.Unmarshal(data, msg); err != nil {
+				return Permanent(fmt.Errorf("decode action %s: %w", action, err))
+			}
+		}
+		return fn(ctx, msg)
+	}
+}
+
+// Dispatch 按 action 分发消息，可直接作为 Serve 的 Handler。
+// action 取自 amqp.Publishing.Type（PublishAction 发送），为空时按旧格式把消息体当作 JSON 编码的 MqMsg 解析。
+func (r *Router) Dispatch(ctx context.Context, d amqp.Delivery) error {
+	codec, ok := CodecFor(d.ContentType)
+	if !ok {
+		return Permanent(fmt.Errorf("unsupported content type %s", d.ContentType))
+	}
+
+	action, data := d.Type, d.Body
+	if action == "" {
+		var msg struct {
+			Action string          `json:"action"`
+			Data   json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(d.Body, &msg); err != nil {
+			return Permanent(fmt.Errorf("decode MqMsg: %w", err))
+		}
+		action, data, codec = msg.Action, msg.Data, JSONCodec{}
+	}
+
+	r.mu.Lock()
+	route, ok := r.routes[action]
+	r.mu.Unlock()
+	if !ok {
+		return Permanent(fmt.Errorf("%w: %s", ErrUnknownAction, action))
+	}
+	return route(ctx, codec, data)
+}
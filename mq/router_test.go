@@ -0,0 +1,81 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type orderMsg struct {
+	ID int `json:"id" msgpack:"id"`
+}
+
+// upperCodec 测试 RegisterCodec：消息体为大写的 JSON
+type upperCodec struct{}
+
+func (upperCodec) ContentType() string { return "application/x-upper-json" }
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := JSONCodec{}.Marshal(v)
+	return []byte(strings.ToUpper(string(data))), err
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	return JSONCodec{}.Unmarshal([]byte(strings.ToLower(string(data))), v)
+}
+
+func TestDispatch(t *testing.T) {
+	RegisterCodec(upperCodec{})
+	packed, _ := msgpack.Marshal(orderMsg{ID: 3})
+	fail := errors.New("handler failed")
+
+	var got *orderMsg
+	r := &Router{}
+	Handle(r, "order.created", func(ctx context.Context, msg *orderMsg) error {
+		got = msg
+		return nil
+	})
+	Handle(r, "order.failed", func(ctx context.Context, msg *orderMsg) error {
+		return fail
+	})
+
+	tests := []struct {
+		name      string
+		d         amqp.Delivery
+		wantID    int
+		wantErr   error
+		permanent bool
+	}{
+		{"type json", amqp.Delivery{Type: "order.created", ContentType: "application/json", Body: []byte(`{"id":1}`)}, 1, nil, false},
+		{"legacy MqMsg", amqp.Delivery{ContentType: "text/plain", Body: []byte(`{"action":"order.created","data":{"id":2}}`)}, 2, nil, false},
+		{"msgpack", amqp.Delivery{Type: "order.created", ContentType: "application/x-msgpack", Body: packed}, 3, nil, false},
+		{"registered codec", amqp.Delivery{Type: "order.created", ContentType: "application/x-upper-json", Body: []byte(`{"ID":4}`)}, 4, nil, false},
+		{"empty data", amqp.Delivery{Type: "order.created"}, 0, nil, false},
+		{"handler error", amqp.Delivery{Type: "order.failed", Body: []byte(`{}`)}, 0, fail, false},
+		{"unknown action", amqp.Delivery{Type: "order.deleted", Body: []byte(`{}`)}, 0, ErrUnknownAction, true},
+		{"unknown legacy action", amqp.Delivery{Body: []byte(`{"action":"order.deleted"}`)}, 0, ErrUnknownAction, true},
+		{"unsupported content type", amqp.Delivery{Type: "order.created", ContentType: "application/xml"}, 0, nil, true},
+		{"decode error", amqp.Delivery{Type: "order.created", Body: []byte(`{"id":"x"}`)}, 0, nil, true},
+		{"legacy body not json", amqp.Delivery{Body: []byte(`hello`)}, 0, nil, true},
+	}
+	for _, tt := range tests {
+		got = nil
+		err := r.Dispatch(context.Background(), tt.d)
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.permanent != IsPermanent(err) {
+			t.Errorf("%s: err = %v, permanent %v", tt.name, err, IsPermanent(err))
+		}
+		if err != nil {
+			continue
+		}
+		if got == nil || got.ID != tt.wantID {
+			t.Errorf("%s: handler got %+v, want id %d", tt.name, got, tt.wantID)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	replyToQueue   = "amq.rabbitmq.reply-to"
+	rpcErrorHeader = "x-rpc-error"
+)
+
+// RPCError 服务端 handler 返回的错误
+type RPCError struct {
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return "rpc: " + e.Message
+}
+
+// RPCClient 基于 direct reply-to 的请求/响应客户端，请求按 ChannelConfig 发送到 exchange
+type RPCClient struct {
+	*Producer
+
+	lock    sync.Mutex
+	pending map[string]chan amqp.Delivery
+}
+
+// NewRPCClient 打开 channel 失败时一直重试，需要处理错误时使用 NewRPCClientContext
+func (client *MQCLIENT) NewRPCClient(cfg *ChannelConfig) *RPCClient {
+	r, err := client.newRPCClient(context.Background(), cfg, client.reconnectPolicy())
+	if err != nil {
+		client.log().Printf("MQ Client new rpc client: %s", err.Error())
+	}
+	return r
+}
+
+func (client *MQCLIENT) NewRPCClientContext(ctx context.Context, cfg *ChannelConfig) (*RPCClient, error) {
+	return client.newRPCClient(ctx, cfg, client.retryPolicy())
+}
+
+func (client *MQCLIENT) newRPCClient(ctx context.Context, cfg *ChannelConfig, policy RetryPolicy) (*RPCClient, error) {
+	r := &RPCClient{pending: make(map[string]chan amqp.Delivery)}
+	p, err := client.newProducer(ctx, cfg, r.consumeReplies, policy)
+	if err != nil {
+		return nil, err
+	}
+	r.Producer = p
+	return r, nil
+}
+
+// consumeReplies direct reply-to 要求在发送请求的同一个 channel 上以 auto ack 订阅
+func (r *RPCClient) consumeReplies(ch *amqp.Channel) error {
+	msgs, err := ch.Consume(
+		replyToQueue, // queue
+		"",           // consumer
+		true,         // auto ack
+		false,        // exclusive
+		false,        // no local
+		false,        // no wait
+		nil,          // args
+	)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for d := range msgs {
+			r.lock.Lock()
+			reply, ok := r.pending[d.CorrelationId]
+			delete(r.pending, d.CorrelationId)
+			r.lock.Unlock()
+			if ok {
+				reply <- d
+			}
+		}
+	}()
+	return nil
+}
+
+// Call 发送请求并等待响应，resp 为 nil 时忽略响应内容，ctx 结束时返回 ctx.Err()
+func (r *RPCClient) Call(ctx context.Context, key string, req interface{}, resp interface{}, opts ...PublishOption) error {
+	if !r.begin() {
+		return ErrClosed
+	}
+	defer r.inflight.Done()
+	msg, err := newPublishing(ctx, r.codec(), "", req, opts)
+	if err != nil {
+		return err
+	}
+	msg.CorrelationId = newMessageId()
+	msg.ReplyTo = replyToQueue
+
+	reply := make(chan amqp.Delivery, 1)
+	r.lock.Lock()
+	r.pending[msg.CorrelationId] = reply
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		delete(r.pending, msg.CorrelationId)
+		r.lock.Unlock()
+	}()
+
+	if err = r.publish(ctx, r.Config.Exchange, key, msg); err != nil {
+		return err
+	}
+
+	select {
+	case d := <-reply:
+		if e, ok := d.Headers[rpcErrorHeader].(string); ok {
+			return &RPCError{Message: e}
+		}
+		if resp == nil {
+			return nil
+		}
+		return Decode(d, resp)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Decode 按消息的 ContentType 解码消息体
+func Decode(d amqp.Delivery, v interface{}) error {
+	codec, ok := CodecFor(d.ContentType)
+	if !ok {
+		return errors.New("unsupported content type " + d.ContentType)
+	}
+	return codec.Unmarshal(d.Body, v)
+}
+
+// RPCHandler 处理请求，返回值按请求的 ContentType 编码后回复给调用方
+type RPCHandler func(ctx context.Context, d amqp.Delivery) (interface{}, error)
+
+// RPCServer 消费 ChannelConfig 声明的队列并回复请求
+type RPCServer struct {
+	*Consumer
+}
+
+// NewRPCServer 打开 channel 失败时一直重试，需要处理错误时使用 NewRPCServerContext
+func (client *MQCLIENT) NewRPCServer(cfg *ChannelConfig) *RPCServer {
+	s, err := client.newRPCServer(context.Background(), cfg, client.reconnectPolicy())
+	if err != nil {
+		client.log().Printf("MQ Client new rpc server: %s", err.Error())
+	}
+	return s
+}
+
+func (client *MQCLIENT) NewRPCServerContext(ctx context.Context, cfg *ChannelConfig) (*RPCServer, error) {
+	return client.newRPCServer(ctx, cfg, client.retryPolicy())
+}
+
+func (client *MQCLIENT) newRPCServer(ctx context.Context, cfg *ChannelConfig, policy RetryPolicy) (*RPCServer, error) {
+	c := *cfg
+	c.ManualAck = true
+	consumer, err := client.newConsumer(ctx, &c, policy)
+	if err != nil {
+		return nil, err
+	}
+	return &RPCServer{consumer}, nil
+}
+
+// Serve handler 的错误会通过 x-rpc-error 头返回给调用方，请求本身被 Ack；回复发送失败时请求重新入队
+func (s *RPCServer) Serve(ctx context.Context, handler RPCHandler) error {
+	return s.Consumer.Serve(ctx, func(ctx context.Context, d amqp.Delivery) error {
+		if d.ReplyTo == "" {
+			return Permanent(errors.New("rpc request without reply_to"))
+		}
+		codec, ok := CodecFor(d.ContentType)
+		if !ok {
+			codec = JSONCodec{}
+		}
+		reply := amqp.Publishing{
+			ContentType:   codec.ContentType(),
+			CorrelationId: d.CorrelationId,
+			Timestamp:     time.Now(),
+		}
+		resp, err := handler(ctx, d)
+		if err == nil {
+			reply.Body, err = codec.Marshal(resp)
+		}
+		if err != nil {
+			reply.Headers = amqp.Table{rpcErrorHeader: err.Error()}
+		}
+		return s.channel().Publish("", d.ReplyTo, false, false, reply)
+	})
+}
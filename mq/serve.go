@@ -0,0 +1,182 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var ErrAutoAck = errors.New("consumer is in auto ack mode, set ChannelConfig.ManualAck to use Serve")
+
+// Handler 处理一条消息：返回 nil 时 Ack，返回普通错误时 Nack 并重新入队；
+// 返回 Permanent 包装的错误时 Reject，配置了 DeadLetterExchange 或 Retry 时进入死信，否则被 broker 丢弃
+type Handler func(ctx context.Context, d amqp.Delivery) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent 标记不可重试的错误，消息将被 Reject 而不是重新入队
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// Serve 以手动确认模式消费消息直到 ctx 结束或 Consumer 关闭，handler panic 时按 Permanent 错误处理：
+// 有死信时进入死信，没有死信时丢弃。
+// handler 的 ctx 中携带消息的 Metadata，在 handler 中使用该 ctx 发送消息会延续 CorrelationId 和 traceparent。
+func (c *Consumer) Serve(ctx context.Context, handler Handler) error {
+	if !c.Config.ManualAck {
+		return ErrAutoAck
+	}
+	if c.Config.Dedup != nil && c.DedupStore == nil {
+		c.DedupStore = NewMemoryDedupStore(0)
+	}
+	return serve(ctx, c.Config, c.RdData, c.done, c.begin, func(ctx context.Context, d amqp.Delivery) {
+		c.handle(ctx, handler, d)
+		c.inflight.Done()
+	})
+}
+
+// serve 读取消息交给 handle 处理。Workers 大于 1 时启动多个 worker，分区 key 相同的消息总由同一个 worker 按顺序处理；
+// 返回前等待已分配给 worker 的消息处理完成。
+func serve(ctx context.Context, cfg *ChannelConfig, deliveries <-chan amqp.Delivery, done <-chan struct{}, begin func() bool, handle func(context.Context, amqp.Delivery)) error {
+	if cfg.Workers <= 1 {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-done:
+				return nil
+			case d, ok := <-deliveries:
+				if !ok || !begin() {
+					return nil
+				}
+				handle(ctx, d)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	workers := make([]chan amqp.Delivery, cfg.Workers)
+	for i := range workers {
+		workers[i] = make(chan amqp.Delivery, 1)
+		wg.Add(1)
+		go func(ch chan amqp.Delivery) {
+			defer wg.Done()
+			for d := range ch {
+				handle(ctx, d)
+			}
+		}(workers[i])
+	}
+	defer func() {
+		for _, ch := range workers {
+			close(ch)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-done:
+			return nil
+		case d, ok := <-deliveries:
+			if !ok || !begin() {
+				return nil
+			}
+			workers[partition(cfg, d)%uint32(len(workers))] <- d
+		}
+	}
+}
+
+// partition 默认按 routing key 分区，配置 PartitionHeader 时使用该消息头的值
+func partition(cfg *ChannelConfig, d amqp.Delivery) uint32 {
+	key := d.RoutingKey
+	if cfg.PartitionHeader != "" {
+		if v, ok := d.Headers[cfg.PartitionHeader]; ok {
+			key = fmt.Sprint(v)
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+func (c *Consumer) handle(ctx context.Context, handler Handler, d amqp.Delivery) {
+	var retry func(amqp.Delivery, error) error
+	if c.Config.Retry != nil {
+		retry = c.retry
+	}
+	metrics := c.Client.metrics()
+	key, dup := c.duplicate(ctx, d)
+	if dup {
+		if err := d.Ack(false); err != nil {
+			c.Logger.Printf("Ack message %d: %s", d.DeliveryTag, err.Error())
+		}
+		metrics.Settled(c.Config.Queue, "duplicate")
+		return
+	}
+	start := time.Now()
+	err := invoke(ContextWithMetadata(ctx, d), handler, d)
+	metrics.Handled(c.Config.Queue, time.Since(start), err)
+	if err == nil && key != "" {
+		c.markDone(ctx, key)
+	}
+	metrics.Settled(c.Config.Queue, settle(c.Logger, d, err, c.Config.deadLettered(), retry))
+}
+
+// settle 根据 handler 的返回值确认消息，retry 不为空时可重试的错误交给 retry 处理，返回确认方式。
+// 队列没有死信时 Reject 会直接丢弃消息，只记录日志；不能重新入队，否则同一条消息会被立即反复投递。
+func settle(logger Logger, d amqp.Delivery, err error, deadLetter bool, retry func(amqp.Delivery, error) error) (outcome string) {
+	var ackErr error
+	switch {
+	case err == nil:
+		outcome, ackErr = "ack", d.Ack(false)
+	case IsPermanent(err) && !deadLetter:
+		logger.Printf("Reject message %d, no dead letter exchange, message dropped: %s", d.DeliveryTag, err.Error())
+		outcome, ackErr = "reject", d.Reject(false)
+	case IsPermanent(err):
+		logger.Printf("Reject message %d: %s", d.DeliveryTag, err.Error())
+		outcome, ackErr = "reject", d.Reject(false)
+	case retry != nil:
+		outcome, ackErr = "retry", retry(d, err)
+	default:
+		logger.Printf("Requeue message %d: %s", d.DeliveryTag, err.Error())
+		outcome, ackErr = "requeue", d.Nack(false, true)
+	}
+	if ackErr != nil {
+		logger.Printf("Ack message %d: %s", d.DeliveryTag, ackErr.Error())
+	}
+	return outcome
+}
+
+func invoke(ctx context.Context, handler Handler, d amqp.Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("handler panic: %v", r))
+		}
+	}()
+	return handler(ctx, d)
+}
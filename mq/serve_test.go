@@ -0,0 +1,176 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+type fakeAck struct {
+	outcome string
+	requeue bool
+}
+
+func (f *fakeAck) Ack(tag uint64, multiple bool) error {
+	f.outcome = "ack"
+	return nil
+}
+
+func (f *fakeAck) Nack(tag uint64, multiple, requeue bool) error {
+	f.outcome, f.requeue = "nack", requeue
+	return nil
+}
+
+func (f *fakeAck) Reject(tag uint64, requeue bool) error {
+	f.outcome, f.requeue = "reject", requeue
+	return nil
+}
+
+func TestHandle(t *testing.T) {
+	fail := errors.New("fail")
+	tests := []struct {
+		name    string
+		handler Handler
+		ack     string
+		requeue bool
+	}{
+		{"ok", func(ctx context.Context, d amqp.Delivery) error { return nil }, "ack", false},
+		{"error requeued", func(ctx context.Context, d amqp.Delivery) error { return fail }, "nack", true},
+		{"permanent rejected", func(ctx context.Context, d amqp.Delivery) error { return Permanent(fail) }, "reject", false},
+		{"panic rejected", func(ctx context.Context, d amqp.Delivery) error { panic("boom") }, "reject", false},
+	}
+	c := &Consumer{Client: &MQCLIENT{}, Config: &ChannelConfig{DeadLetterExchange: "dlx"}, Logger: log.New(io.Discard, "", 0)}
+	for _, tt := range tests {
+		ack := &fakeAck{}
+		c.handle(context.Background(), tt.handler, amqp.Delivery{Acknowledger: ack})
+		if ack.outcome != tt.ack || ack.requeue != tt.requeue {
+			t.Errorf("%s: %s (requeue %v), want %s (requeue %v)", tt.name, ack.outcome, ack.requeue, tt.ack, tt.requeue)
+		}
+	}
+}
+
+func TestServeAutoAck(t *testing.T) {
+	c := &Consumer{Config: &ChannelConfig{}}
+	if err := c.Serve(context.Background(), nil); err != ErrAutoAck {
+		t.Fatalf("Serve = %v, want ErrAutoAck", err)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	cfg := &ChannelConfig{}
+	a := partition(cfg, amqp.Delivery{RoutingKey: "order.1"})
+	if b := partition(cfg, amqp.Delivery{RoutingKey: "order.1"}); a != b {
+		t.Fatalf("same routing key: %d != %d", a, b)
+	}
+
+	cfg = &ChannelConfig{PartitionHeader: "tenant"}
+	x := partition(cfg, amqp.Delivery{RoutingKey: "order.1", Headers: amqp.Table{"tenant": int32(7)}})
+	y := partition(cfg, amqp.Delivery{RoutingKey: "order.2", Headers: amqp.Table{"tenant": int32(7)}})
+	if x != y {
+		t.Fatalf("same partition header: %d != %d", x, y)
+	}
+	// 没有该消息头时按 routing key
+	if z := partition(cfg, amqp.Delivery{RoutingKey: "order.1"}); z != a {
+		t.Fatalf("missing header: %d != %d", z, a)
+	}
+}
+
+func TestServeOrderedPerKey(t *testing.T) {
+	const n = 200
+	deliveries := make(chan amqp.Delivery, n)
+	for i := 0; i < n; i++ {
+		deliveries <- amqp.Delivery{RoutingKey: fmt.Sprint("key", i%5), DeliveryTag: uint64(i)}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu    sync.Mutex
+		seen  = map[string][]uint64{}
+		count int
+	)
+	err := serve(ctx, &ChannelConfig{Workers: 4}, deliveries, nil, func() bool { return true }, func(ctx context.Context, d amqp.Delivery) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[d.RoutingKey] = append(seen[d.RoutingKey], d.DeliveryTag)
+		if count++; count == n {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("serve = %v, want context.Canceled", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if count != n {
+		t.Fatalf("handled %d, want %d", count, n)
+	}
+	for key, tags := range seen {
+		for i := 1; i < len(tags); i++ {
+			if tags[i] < tags[i-1] {
+				t.Fatalf("%s out of order: %v", key, tags)
+			}
+		}
+	}
+}
+
+func TestSettle(t *testing.T) {
+	retry := func(d amqp.Delivery, err error) error { return d.Ack(false) }
+	fail := errors.New("fail")
+	tests := []struct {
+		name       string
+		err        error
+		deadLetter bool
+		retry      func(amqp.Delivery, error) error
+		want       string
+		ack        string
+		requeue    bool
+	}{
+		{"ok", nil, false, nil, "ack", "ack", false},
+		{"error requeued", fail, false, nil, "requeue", "nack", true},
+		{"error retried", fail, true, retry, "retry", "ack", false},
+		{"permanent dead lettered", Permanent(fail), true, nil, "reject", "reject", false},
+		{"permanent without dead letter", Permanent(fail), false, nil, "reject", "reject", false},
+	}
+	logger := log.New(io.Discard, "", 0)
+	for _, tt := range tests {
+		ack := &fakeAck{}
+		got := settle(logger, amqp.Delivery{Acknowledger: ack}, tt.err, tt.deadLetter, tt.retry)
+		if got != tt.want || ack.outcome != tt.ack || ack.requeue != tt.requeue {
+			t.Errorf("%s: settle = %s (%s, requeue %v), want %s (%s, requeue %v)",
+				tt.name, got, ack.outcome, ack.requeue, tt.want, tt.ack, tt.requeue)
+		}
+	}
+}
+
+func TestServePermanentNotRequeued(t *testing.T) {
+	b := NewMemBroker()
+	c := b.NewConsumer(&ChannelConfig{Queue: "jobs", ManualAck: true})
+	c.Logger = log.New(io.Discard, "", 0)
+	defer c.Close(context.Background())
+	var calls int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Serve(ctx, func(ctx context.Context, d amqp.Delivery) error {
+		atomic.AddInt32(&calls, 1)
+		return Permanent(errors.New("bad message"))
+	})
+	b.Publish("", "jobs", amqp.Publishing{Body: []byte("x")})
+
+	wctx, wcancel := context.WithTimeout(ctx, time.Second)
+	defer wcancel()
+	if err := b.WaitIdle(wctx, "jobs"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("handler called %d times, want 1", n)
+	}
+}
@@ -0,0 +1,195 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Topology 描述需要声明的 exchange、queue、binding 和 policy，可从 JSON 或 YAML 文件加载
+type Topology struct {
+	Exchanges []ExchangeSpec `json:"exchanges" yaml:"exchanges"`
+	Queues    []QueueSpec    `json:"queues" yaml:"queues"`
+	Bindings  []BindingSpec  `json:"bindings" yaml:"bindings"`
+	// Policies 通过管理 API 设置，需要 Management
+	Policies []PolicySpec `json:"policies" yaml:"policies"`
+}
+
+type ExchangeSpec struct {
+	Name       string                 `json:"name" yaml:"name"`
+	Type       string                 `json:"type" yaml:"type"`
+	Durable    bool                   `json:"durable" yaml:"durable"`
+	AutoDelete bool                   `json:"auto_delete" yaml:"auto_delete"`
+	Internal   bool                   `json:"internal" yaml:"internal"`
+	Arguments  map[string]interface{} `json:"arguments" yaml:"arguments"`
+}
+
+type QueueSpec struct {
+	Name string `json:"name" yaml:"name"`
+	// Type classic、quorum 或 stream，quorum 和 stream 队列总是持久化
+	Type       string                 `json:"type" yaml:"type"`
+	Durable    bool                   `json:"durable" yaml:"durable"`
+	AutoDelete bool                   `json:"auto_delete" yaml:"auto_delete"`
+	Exclusive  bool                   `json:"exclusive" yaml:"exclusive"`
+	Arguments  map[string]interface{} `json:"arguments" yaml:"arguments"`
+}
+
+// BindingSpec DestinationType 为 queue（默认）或 exchange
+type BindingSpec struct {
+	Source          string                 `json:"source" yaml:"source"`
+	Destination     string                 `json:"destination" yaml:"destination"`
+	DestinationType string                 `json:"destination_type" yaml:"destination_type"`
+	Key             string                 `json:"key" yaml:"key"`
+	Arguments       map[string]interface{} `json:"arguments" yaml:"arguments"`
+}
+
+type PolicySpec struct {
+	Name    string `json:"name" yaml:"name"`
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// ApplyTo queues、exchanges 或 all，默认 all
+	ApplyTo    string                 `json:"apply_to" yaml:"apply_to"`
+	Priority   int                    `json:"priority" yaml:"priority"`
+	Definition map[string]interface{} `json:"definition" yaml:"definition"`
+}
+
+const (
+	DestinationQueue    = "queue"
+	DestinationExchange = "exchange"
+)
+
+// LoadTopology 按扩展名解析文件，.yaml/.yml 为 YAML，其余按 JSON 解析
+func LoadTopology(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &Topology{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, t)
+	default:
+		err = json.Unmarshal(data, t)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mq topology %s: %w", path, err)
+	}
+	if err = t.Validate(); err != nil {
+		return nil, fmt.Errorf("mq topology %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func (t *Topology) Validate() error {
+	for _, e := range t.Exchanges {
+		if e.Name == "" || e.Type == "" {
+			return errors.New("exchange requires name and type")
+		}
+	}
+	for _, q := range t.Queues {
+		if q.Name == "" {
+			return errors.New("queue requires name")
+		}
+	}
+	for _, b := range t.Bindings {
+		if b.Source == "" || b.Destination == "" {
+			return errors.New("binding requires source and destination")
+		}
+		if b.DestinationType != "" && b.DestinationType != DestinationQueue && b.DestinationType != DestinationExchange {
+			return errors.New("invalid binding destination type " + b.DestinationType)
+		}
+	}
+	for _, p := range t.Policies {
+		if p.Name == "" || p.Pattern == "" {
+			return errors.New("policy requires name and pattern")
+		}
+	}
+	return nil
+}
+
+func (q *QueueSpec) durable() bool {
+	return q.Durable || q.Type == QueueQuorum || q.Type == QueueStream
+}
+
+func (q *QueueSpec) args() map[string]interface{} {
+	args := map[string]interface{}{}
+	for k, v := range q.Arguments {
+		args[k] = v
+	}
+	if q.Type != "" {
+		args["x-queue-type"] = q.Type
+	}
+	return args
+}
+
+func (b *BindingSpec) destinationType() string {
+	if b.DestinationType == "" {
+		return DestinationQueue
+	}
+	return b.DestinationType
+}
+
+func (p *PolicySpec) applyTo() string {
+	if p.ApplyTo == "" {
+		return "all"
+	}
+	return p.ApplyTo
+}
+
+// DeclareTopology 按 exchange、queue、binding、policy 的顺序声明，已存在且参数一致的对象不受影响，可在每次启动时调用；
+// 参数不一致时 broker 拒绝声明并返回错误，可先用 Management.Diff 检查。mgmt 仅在有 Policies 时需要。
+func (client *MQCLIENT) DeclareTopology(ctx context.Context, t *Topology, mgmt *Management) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if len(t.Policies) > 0 && mgmt == nil {
+		return errors.New("mq topology: policies require management api")
+	}
+	ch, err := client.conn().Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for _, e := range t.Exchanges {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		err = ch.ExchangeDeclare(e.Name, e.Type, e.Durable, e.AutoDelete, e.Internal, false, amqpTable(e.Arguments))
+		if err != nil {
+			return fmt.Errorf("mq topology exchange %s: %w", e.Name, err)
+		}
+	}
+	for _, q := range t.Queues {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		_, err = ch.QueueDeclare(q.Name, q.durable(), q.AutoDelete, q.Exclusive, false, amqpTable(q.args()))
+		if err != nil {
+			return fmt.Errorf("mq topology queue %s: %w", q.Name, err)
+		}
+	}
+	for _, b := range t.Bindings {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if b.destinationType() == DestinationExchange {
+			err = ch.ExchangeBind(b.Destination, b.Key, b.Source, false, amqpTable(b.Arguments))
+		} else {
+			err = ch.QueueBind(b.Destination, b.Key, b.Source, false, amqpTable(b.Arguments))
+		}
+		if err != nil {
+			return fmt.Errorf("mq topology binding %s -> %s: %w", b.Source, b.Destination, err)
+		}
+	}
+	for _, p := range t.Policies {
+		if err = mgmt.PutPolicy(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}